@@ -6,13 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/arielsrv/go-archaius/event"
 	"github.com/arielsrv/go-archaius/pkg/cast"
 	"github.com/arielsrv/go-archaius/source"
 	"github.com/arielsrv/go-archaius/source/cli"
+	"github.com/arielsrv/go-archaius/source/defaults"
 	"github.com/arielsrv/go-archaius/source/env"
 	"github.com/arielsrv/go-archaius/source/mem"
+	"github.com/arielsrv/go-archaius/source/util"
 	"github.com/sirupsen/logrus"
 
 	"os"
@@ -21,13 +26,28 @@ import (
 	filesource "github.com/arielsrv/go-archaius/source/file"
 )
 
+// ProfilesKey is the command line argument and ProfilesEnv the env replacing the profiles of WithProfiles.
+const (
+	ProfilesKey = "archaius.profiles"
+	ProfilesEnv = "ARCHAIUS_PROFILES"
+)
+
 var (
 	manager             *source.Manager
 	fs                  filesource.FileSource
+	defaultsSource      *defaults.Source
 	running             = false
 	configServerRunning = false
 )
 
+var (
+	profiles []string
+	// profileFiles maps the profile files to their profile
+	profileFiles = make(map[string]string)
+	// fileSources are the file sources of WithNamedFileSource by name
+	fileSources = make(map[string]filesource.FileSource)
+)
+
 func init() {
 	// Log as JSON instead of the default ASCII formatter.
 	logrus.SetFormatter(&nested.Formatter{
@@ -41,10 +61,17 @@ func init() {
 func initFileSource(o *Options) (filesource.FileSource, error) {
 	files := make([]string, 0)
 	// created file source object
-	fs = filesource.NewFileSource()
+	fs = filesource.NewFileSource(fileSourceOptions(o)...)
 	// adding all files with file source
+	for i, v := range o.LayeredFiles {
+		if err := addFile(fs, v, uint32(len(o.LayeredFiles)-i), o.FileHandler); err != nil {
+			logrus.Error(fmt.Sprintf("add file source error [%s].", err.Error()))
+			return nil, err
+		}
+		files = append(files, v)
+	}
 	for _, v := range o.RequiredFiles {
-		if err := fs.AddFile(v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
+		if err := addFile(fs, v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
 			logrus.Error(fmt.Sprintf("add file source error [%s].", err.Error()))
 			return nil, err
 		}
@@ -56,7 +83,7 @@ func initFileSource(o *Options) (filesource.FileSource, error) {
 			logrus.Info(fmt.Sprintf("[%s] not exist", v))
 			continue
 		}
-		if err := fs.AddFile(v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
+		if err := addFile(fs, v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
 			logrus.Info(err.Error())
 			return nil, err
 		}
@@ -69,6 +96,86 @@ func initFileSource(o *Options) (filesource.FileSource, error) {
 	return fs, nil
 }
 
+// fileSourceOptions returns the options of all file sources.
+func fileSourceOptions(o *Options) []filesource.Option {
+	fileOpts := []filesource.Option{filesource.WithPollInterval(o.FilePollInterval)}
+	if o.FileWatchMode != "" {
+		fileOpts = append(fileOpts, filesource.WithWatchMode(o.FileWatchMode))
+	}
+	return fileOpts
+}
+
+// addNamedFileSources creates the file sources of WithNamedFileSource, each with its own source priority.
+func addNamedFileSources(o *Options) error {
+	for _, n := range o.NamedFileSources {
+		s := filesource.NewFileSource(append(fileSourceOptions(o),
+			filesource.WithName(n.Name), filesource.WithPriority(n.Priority))...)
+		for _, v := range n.Files {
+			if err := addFile(s, v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
+				logrus.Error(fmt.Sprintf("add file source %s error [%s].", n.Name, err.Error()))
+				return err
+			}
+			logrus.Info(fmt.Sprintf("loaded configuration file of %s: %s", n.Name, v))
+		}
+		if err := manager.AddSource(s); err != nil {
+			return err
+		}
+		fileSources[n.Name] = s
+	}
+	return nil
+}
+
+// addFile adds a file, then its profile files at increasing precedence. they all keep the given priority,
+// the profile files are ranked above the file by layer, so they never override a file of higher precedence.
+func addFile(fileSource filesource.FileSource, file string, priority uint32, handler util.FileHandler,
+	opts ...filesource.DirOption) error {
+	layered := func(layer int) []filesource.DirOption {
+		return append(append([]filesource.DirOption{}, opts...), filesource.Layer(uint32(layer)))
+	}
+	if err := fileSource.AddFile(file, priority, handler, layered(len(profiles))...); err != nil {
+		return err
+	}
+	ext := filepath.Ext(file)
+	for i, profile := range profiles {
+		p := strings.TrimSuffix(file, ext) + "-" + profile + ext
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := fileSource.AddFile(p, priority, handler, layered(len(profiles)-1-i)...); err != nil {
+			return err
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			profileFiles[abs] = profile
+		}
+		logrus.Info(fmt.Sprintf("loaded profile %s file: %s", profile, p))
+	}
+	return nil
+}
+
+// activeProfiles returns the profiles given by command line argument, env or WithProfiles in that order.
+func activeProfiles(o *Options) []string {
+	value := os.Getenv(ProfilesEnv)
+	args := os.Args[1:]
+	for i, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--"+ProfilesKey+"="):
+			value = strings.TrimPrefix(arg, "--"+ProfilesKey+"=")
+		case arg == "--"+ProfilesKey && i+1 < len(args):
+			value = args[i+1]
+		}
+	}
+	if value == "" {
+		return o.Profiles
+	}
+	result := make([]string, 0)
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
 // Init create a Archaius config singleton.
 func Init(opts ...Option) error {
 	if running {
@@ -81,7 +188,24 @@ func Init(opts ...Option) error {
 		opt(o)
 	}
 
-	manager = source.NewManager()
+	managerOpts := []source.Option{
+		source.WithUnmarshalOptions(o.UnmarshalOptions...),
+		source.WithValueTransformers(o.ValueTransformers...),
+		source.WithCipher(o.Cipher),
+		source.WithKeySeparator(o.KeySeparator),
+		source.WithSensitiveKeys(o.SensitiveKeys...),
+	}
+	if o.LowerCaseKeys {
+		managerOpts = append(managerOpts, source.WithLowerCaseKeys())
+	}
+	for name, n := range o.KeyNormalizers {
+		managerOpts = append(managerOpts, source.WithSourceKeyNormalizer(name, n))
+	}
+	manager = source.NewManager(managerOpts...)
+	defaultsSource = nil
+	profiles = activeProfiles(o)
+	profileFiles = make(map[string]string)
+	fileSources = make(map[string]filesource.FileSource)
 
 	fs, err := initFileSource(o)
 	if err != nil {
@@ -91,6 +215,9 @@ func Init(opts ...Option) error {
 	if err != nil {
 		return err
 	}
+	if err = addNamedFileSources(o); err != nil {
+		return err
+	}
 
 	if o.RemoteSource != "" {
 		if err = EnableRemoteSource(o.RemoteSource, o.RemoteInfo); err != nil {
@@ -160,10 +287,13 @@ func Get(key string) interface{} {
 }
 
 // GetValue return interface.
+// the value has an error if a reference to other keys in it is unresolved or references form a cycle.
 func GetValue(key string) cast.Value {
 	var confValue cast.Value
-	val := manager.GetConfig(key)
-	if val == nil {
+	val, err := manager.GetConfigE(key)
+	if err != nil {
+		confValue = cast.NewValue(nil, err)
+	} else if val == nil {
 		confValue = cast.NewValue(nil, source.ErrKeyNotExist)
 	} else {
 		confValue = cast.NewValue(val, nil)
@@ -177,13 +307,43 @@ func Exist(key string) bool {
 }
 
 // UnmarshalConfig unmarshal the config of receiving object.
-func UnmarshalConfig(obj interface{}) error {
-	return manager.Unmarshal(obj)
+func UnmarshalConfig(obj interface{}, opts ...UnmarshalOption) error {
+	return manager.Unmarshal(obj, opts...)
 }
 
-// WriteTo write the config to writer by yaml.
-func WriteTo(w io.Writer) error {
-	return manager.Marshal(w)
+// RegisterDecoder registers a func which converts config values into type t,
+// UnmarshalConfig uses it for the struct fields of type t.
+func RegisterDecoder(t reflect.Type, f func(interface{}) (interface{}, error)) {
+	source.RegisterDecoder(t, f)
+}
+
+// RegisterAlias makes oldKey another name of newKey, so a key can be renamed while the sources still provide the old key,
+// reading either key returns the same value and listeners of both keys get the events.
+// with Deprecated a warning is logged once if a source still provides oldKey.
+func RegisterAlias(oldKey, newKey string, opts ...AliasOption) error {
+	return manager.RegisterAlias(oldKey, newKey, opts...)
+}
+
+// SecretResolver resolves the secret references of a scheme, like ${vault:secret/db}.
+type SecretResolver = source.SecretResolver
+
+// RegisterSecretResolver registers the resolver of scheme, file and env are registered by default.
+// the secret references are resolved by Get, GetValue and UnmarshalConfig,
+// GetConfigs, WriteTo and events keep the references.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	source.RegisterSecretResolver(scheme, r)
+}
+
+// UnRegisterSecretResolver removes the resolver of scheme.
+func UnRegisterSecretResolver(scheme string) {
+	source.UnRegisterSecretResolver(scheme)
+}
+
+// WriteTo write the config to writer, by yaml and grouped by source name by default,
+// use Format and View to change it, for example WriteTo(w, Format(JSON), View(Merged)).
+// the values of sensitive keys are masked.
+func WriteTo(w io.Writer, opts ...WriteOption) error {
+	return manager.Marshal(w, opts...)
 }
 
 // GetBool is gives the key value in the form of bool.
@@ -229,6 +389,23 @@ func GetConfigs() map[string]interface{} {
 	return manager.Configs()
 }
 
+// Keys returns the sorted keys matching the glob pattern, like redis.* or *.timeout,
+// * also matches dots, an empty pattern matches all keys.
+func Keys(pattern string) []string {
+	return manager.Keys(pattern)
+}
+
+// GetByPrefix returns the key values which are prefix or under it, like redis.addr for redis.
+func GetByPrefix(prefix string) map[string]interface{} {
+	return manager.GetByPrefix(prefix)
+}
+
+// GetTree returns the key values under prefix as nested maps relative to prefix,
+// for example {pool: {size: 10}} for prefix redis and key redis.pool.size.
+func GetTree(prefix string) map[string]interface{} {
+	return manager.GetTree(prefix)
+}
+
 // GetConfigsWithSourceNames gives the information about all configurations
 // each config key, along with its source will be returned
 // the returned map will be like:
@@ -260,23 +437,103 @@ func RegisterModuleListener(listenerObj event.ModuleListener, prefix ...string)
 // UnRegisterModuleListener is to remove the moduleListener.
 
 // AddFile is for to add the configuration files at runtime.
+// a directory or a path with glob patterns like conf.d/**/*.yaml manages the matching files,
+// also the ones created later.
 func AddFile(file string, opts ...FileOption) error {
 	o := &FileOptions{}
 	for _, f := range opts {
 		f(o)
 	}
-	if err := fs.AddFile(file, filesource.DefaultFilePriority, o.Handler); err != nil {
+	target := fs
+	if o.SourceName != "" {
+		s, ok := fileSources[o.SourceName]
+		if !ok {
+			return fmt.Errorf("file source %s not exist", o.SourceName)
+		}
+		target = s
+	}
+	if err := addFile(target, file, o.Priority, o.Handler, o.DirOptions...); err != nil {
 		return err
 	}
-	return manager.Refresh(fs.GetSourceName())
+	return manager.Refresh(target.GetSourceName())
+}
+
+// FileRanks returns the priority and the layer applied to each file of the file source,
+// a profile file has the priority of the file it overlays and a lower layer. it is nil before Init.
+func FileRanks() map[string]filesource.FileRank {
+	if fs == nil {
+		return nil
+	}
+	return fs.FileRanks()
+}
+
+// Explanation tells where the value of a key comes from,
+// Profile is the profile of the file providing the value, empty if it is not a profile file.
+type Explanation struct {
+	source.Explanation
+	Profile string
+}
+
+// Explain tells which source, and file for the file source, provides the value of key,
+// and what the other sources hold for it.
+func Explain(key string) (*Explanation, error) {
+	e, err := manager.Explain(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Explanation{Explanation: *e, Profile: profileFiles[e.Origin]}, nil
 }
 
 // Set add the configuration key, value pairs into memory source at runtime
 // it is just affect the local configs.
-func Set(key string, value interface{}) error {
+func Set(key string, value interface{}, opts ...SetOption) error {
+	o := &SetOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Sensitive {
+		manager.MarkSensitive(key)
+	}
 	return manager.Set(key, value)
 }
 
+// SetStruct writes the fields of obj into memory source under prefix,
+// the keys are made by the same tag rules as UnmarshalConfig,
+// all keys are set in one batch, so module listeners get one event for them.
+func SetStruct(prefix string, obj interface{}) error {
+	kvs, err := manager.Flatten(prefix, obj)
+	if err != nil {
+		return err
+	}
+	return manager.SetBatch(kvs)
+}
+
+// DefaultsFrom registers the current field values of obj as defaults,
+// they have the lowest priority, so any source which has the key overrides them.
+// calling it again merges the new defaults into the existing ones.
+func DefaultsFrom(obj interface{}) error {
+	kvs, err := manager.Flatten("", obj)
+	if err != nil {
+		return err
+	}
+	if defaultsSource == nil {
+		ds := defaults.NewDefaultsSource()
+		if err := ds.AddDefaults(kvs); err != nil {
+			return err
+		}
+		if err := manager.AddSource(ds); err != nil {
+			return err
+		}
+		defaultsSource = ds
+		return nil
+	}
+	if err := defaultsSource.AddDefaults(kvs); err != nil {
+		return err
+	}
+	// the watch of the source is started asynchronously by AddSource, the defaults may come before it
+	return manager.Refresh(defaults.Name)
+}
+
 // Delete delete the configuration key, value pairs in memory source.
 func Delete(key string) error {
 	return manager.Delete(key)
@@ -288,7 +545,12 @@ func Delete(key string) error {
 // it deletes all sources which means all of key value is deleted.
 // after you call Clean, you can init archaius again.
 func Clean() error {
+	if manager == nil {
+		// not initialized yet
+		return nil
+	}
 	manager.Cleanup()
+	defaultsSource = nil
 	running = false
 	return nil
 }
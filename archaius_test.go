@@ -2,16 +2,33 @@ package archaius_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 
 	"github.com/arielsrv/go-archaius"
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/cipher"
+	"github.com/arielsrv/go-archaius/pkg/redact"
+	"github.com/arielsrv/go-archaius/source"
+	"github.com/arielsrv/go-archaius/source/defaults"
+	"github.com/arielsrv/go-archaius/source/env"
+	filesource "github.com/arielsrv/go-archaius/source/file"
+	"github.com/arielsrv/go-archaius/source/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -282,6 +299,52 @@ func TestClean(t *testing.T) {
 	s := archaius.Get("age")
 	assert.Equal(t, nil, s)
 }
+func TestRemovedFileFallback(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	dir := t.TempDir()
+	high, low := filepath.Join(dir, "high.yaml"), filepath.Join(dir, "low.yaml")
+	err = os.WriteFile(high, []byte("removed:\n  name: high\n  only: high\n"), 0600)
+	assert.NoError(t, err)
+	err = os.WriteFile(low, []byte("removed:\n  name: low\n"), 0600)
+	assert.NoError(t, err)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(high, archaius.WithFilePriority(0))
+	assert.NoError(t, err)
+	err = archaius.AddFile(low, archaius.WithFilePriority(1))
+	assert.NoError(t, err)
+	// let the file watcher start
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "high", archaius.GetString("removed.name", ""))
+
+	t.Run("removed file falls back to another file", func(t *testing.T) {
+		err := os.Remove(high)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return archaius.GetString("removed.name", "") == "low" && !archaius.Exist("removed.only")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("removed file is added again when it comes back", func(t *testing.T) {
+		err := os.WriteFile(high, []byte("removed:\n  name: back\n"), 0600)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return archaius.GetString("removed.name", "") == "back"
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("last file removed deletes the keys", func(t *testing.T) {
+		err := os.Remove(high)
+		assert.NoError(t, err)
+		err = os.Remove(low)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return !archaius.Exist("removed.name")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+}
+
 func TestInitConfigBool2String(t *testing.T) {
 	b := []byte(`
 ssl:
@@ -322,3 +385,1504 @@ ssl:
 	assert.Equal(t, "private.pem", sslConfig.Ssl["rest.Provider.keyFile"])
 	assert.Equal(t, "PwdFile.yaml", sslConfig.Ssl["rest.Provider.certPwdFile"])
 }
+
+func TestUnmarshalConfigStrict(t *testing.T) {
+	b := []byte(`
+strict:
+  timeout: 5s
+  timout: 6s
+  name: peter
+  since: 2023-01-02T15:04:05Z
+lb:
+  strategy: random
+  backend1:
+    host: 10.0.0.1
+  backend2:
+    host: 10.0.0.2
+verbose: true
+svc:
+  name: api
+  other: x
+  tags:
+    team: core
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "strict.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	t.Setenv("STRICT_ENV_ONLY", "ignored")
+	archaius.Clean()
+	defer archaius.Clean()
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithENVSource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	type Section struct {
+		Timeout string     `yaml:"timeout"`
+		Name    string     `yaml:"name"`
+		Port    int        `yaml:"port"`
+		Since   time.Time  `yaml:"since"`
+		Until   time.Time  `yaml:"until"`
+		Expires *time.Time `yaml:"expires"`
+	}
+	type Config struct {
+		Strict Section `yaml:"strict"`
+	}
+	t.Run("not strict", func(t *testing.T) {
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c)
+		assert.NoError(t, err)
+		assert.Equal(t, "5s", c.Strict.Timeout)
+		assert.NotNil(t, c.Strict.Expires)
+	})
+	t.Run("strict", func(t *testing.T) {
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c, archaius.Strict())
+		var strictErr *source.StrictError
+		assert.ErrorAs(t, err, &strictErr)
+		// the top-level keys the struct does not model, like lb and verbose, and the env keys are not reported
+		assert.Equal(t, []string{"strict.timout"}, strictErr.UnknownKeys)
+		assert.Equal(t, []string{"strict.expires", "strict.port", "strict.until"}, strictErr.UnsetFields)
+		assert.Equal(t, "peter", c.Strict.Name)
+		assert.Equal(t, 2023, c.Strict.Since.Year())
+	})
+	t.Run("strict with inline map", func(t *testing.T) {
+		type Backend struct {
+			Host string `yaml:"host"`
+		}
+		type LB struct {
+			Strategy string             `yaml:"strategy"`
+			Backends map[string]Backend `yaml:",inline"`
+		}
+		type InlineConfig struct {
+			LB      LB                     `yaml:"lb"`
+			Strict  map[string]interface{} `yaml:"strict"`
+			Verbose bool                   `yaml:"verbose"`
+		}
+		c := &InlineConfig{}
+		err := archaius.UnmarshalConfig(c, archaius.Strict())
+		assert.NoError(t, err)
+		assert.Equal(t, "random", c.LB.Strategy)
+		assert.Equal(t, "10.0.0.2", c.LB.Backends["backend2"].Host)
+	})
+	t.Run("strict with inline map of a section", func(t *testing.T) {
+		type Svc struct {
+			Name  string                 `yaml:"name"`
+			Extra map[string]interface{} `yaml:",inline"`
+		}
+		type SvcConfig struct {
+			Svc Svc `yaml:"svc"`
+		}
+		c := &SvcConfig{}
+		err := archaius.UnmarshalConfig(c, archaius.Strict())
+		assert.NoError(t, err)
+		assert.Equal(t, "api", c.Svc.Name)
+		assert.Equal(t, map[string]interface{}{"other": "x", "tags": map[string]interface{}{"team": "core"}},
+			c.Svc.Extra)
+	})
+	t.Run("strict with inline map not taking a key", func(t *testing.T) {
+		type Tag struct {
+			Team string `yaml:"team"`
+		}
+		type Svc struct {
+			Name string         `yaml:"name"`
+			Tags map[string]Tag `yaml:",inline"`
+		}
+		type SvcConfig struct {
+			Svc Svc `yaml:"svc"`
+		}
+		c := &SvcConfig{}
+		err := archaius.UnmarshalConfig(c, archaius.Strict())
+		var strictErr *source.StrictError
+		assert.ErrorAs(t, err, &strictErr)
+		// svc.other can not be set into the map, so it is not consumed
+		assert.Equal(t, []string{"svc.other"}, strictErr.UnknownKeys)
+		assert.Equal(t, "core", c.Svc.Tags["tags"].Team)
+	})
+	t.Run("ignored and unexported fields", func(t *testing.T) {
+		type Partial struct {
+			Timeout string `yaml:"timeout"`
+			Skipped string `yaml:"-"`
+			// a field after an ignored one is still set
+			Name string `yaml:"name"`
+			// an unexported field is never set, nor reported
+			port int
+		}
+		c := &Partial{}
+		err := archaius.UnmarshalConfig(c, source.WithPrefix("strict"))
+		assert.NoError(t, err)
+		assert.Equal(t, "5s", c.Timeout)
+		assert.Equal(t, "", c.Skipped)
+		assert.Equal(t, "peter", c.Name)
+		assert.Equal(t, 0, c.port)
+	})
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+type celsius float64
+
+func TestUnmarshalConfigRichTypes(t *testing.T) {
+	b := []byte(`
+rich:
+  timeout: 1m30s
+  interval: 1000
+  since: 2023-01-02T15:04:05Z
+  endpoint: https://example.com:8443/api?x=1
+  ip: 10.0.0.1
+  cidr: 10.0.0.0/8
+  pattern: ^a.*z$
+  level: info
+  temperature: 21.5C
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "rich.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	archaius.RegisterDecoder(reflect.TypeOf(celsius(0)), func(v interface{}) (interface{}, error) {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v.(string), "C"), 64)
+		return celsius(f), err
+	})
+	type Rich struct {
+		Timeout     time.Duration  `yaml:"timeout"`
+		Interval    time.Duration  `yaml:"interval"`
+		Since       time.Time      `yaml:"since"`
+		Endpoint    *url.URL       `yaml:"endpoint"`
+		IP          net.IP         `yaml:"ip"`
+		CIDR        net.IPNet      `yaml:"cidr"`
+		Pattern     *regexp.Regexp `yaml:"pattern"`
+		Level       level          `yaml:"level"`
+		Temperature celsius        `yaml:"temperature"`
+	}
+	type Config struct {
+		Rich Rich `yaml:"rich"`
+	}
+	c := &Config{}
+	err = archaius.UnmarshalConfig(c)
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, c.Rich.Timeout)
+	assert.Equal(t, 1000*time.Nanosecond, c.Rich.Interval)
+	assert.Equal(t, 2023, c.Rich.Since.Year())
+	assert.Equal(t, "example.com:8443", c.Rich.Endpoint.Host)
+	assert.Equal(t, "10.0.0.1", c.Rich.IP.String())
+	assert.Equal(t, "10.0.0.0/8", c.Rich.CIDR.String())
+	assert.True(t, c.Rich.Pattern.MatchString("abcz"))
+	assert.Equal(t, level(1), c.Rich.Level)
+	assert.Equal(t, celsius(21.5), c.Rich.Temperature)
+
+	t.Run("invalid value", func(t *testing.T) {
+		archaius.Set("rich.level", "trace")
+		defer archaius.Delete("rich.level")
+		err := archaius.UnmarshalConfig(&Config{})
+		assert.Error(t, err)
+	})
+}
+
+func TestUnmarshalConfigTagName(t *testing.T) {
+	b := []byte(`
+api:
+  listenAddr: 0.0.0.0:8080
+  read_timeout: 5s
+  maxconns: 100
+  backends:
+    - host: 10.0.0.1
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "tag.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	type Backend struct {
+		Host string
+	}
+	type API struct {
+		ListenAddr  string        `json:"listenAddr,omitempty"`
+		ReadTimeout time.Duration `mapstructure:"read_timeout" json:"readTimeout"`
+		MaxConns    int
+		Backends    []Backend `json:"backends"`
+	}
+	type Config struct {
+		API API `json:"api"`
+	}
+	t.Run("tag fallback chain", func(t *testing.T) {
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c, archaius.TagName("mapstructure", "json", "yaml"))
+		assert.NoError(t, err)
+		assert.Equal(t, "0.0.0.0:8080", c.API.ListenAddr)
+		assert.Equal(t, 5*time.Second, c.API.ReadTimeout)
+		assert.Equal(t, 0, c.API.MaxConns)
+	})
+	t.Run("case insensitive", func(t *testing.T) {
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c, archaius.TagName("mapstructure", "json"), archaius.CaseInsensitive())
+		assert.NoError(t, err)
+		assert.Equal(t, 100, c.API.MaxConns)
+		assert.Equal(t, "10.0.0.1", c.API.Backends[0].Host)
+	})
+}
+
+func TestIndexedKeys(t *testing.T) {
+	b := []byte(`
+cluster:
+  servers:
+    - host: 10.0.0.1
+      port: 8080
+    - host: 10.0.0.2
+      port: 8080
+`)
+	b2 := []byte(`
+pool:
+  servers:
+    - host: 10.0.1.1
+      port: 8080
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "indexed.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	filename2 := filepath.Join(d, "indexed2.yaml")
+	err = os.WriteFile(filename2, b2, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename2)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename2, archaius.WithFileHandler(util.Convert2IndexedJavaProps))
+	assert.NoError(t, err)
+
+	type Server struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+	type Group struct {
+		Servers []Server `yaml:"servers"`
+	}
+	type Config struct {
+		Cluster Group `yaml:"cluster"`
+		Pool    Group `yaml:"pool"`
+	}
+	t.Run("get indexed key from array value", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.2", archaius.GetString("cluster.servers.1.host", ""))
+		assert.Equal(t, "10.0.0.2", archaius.GetString("cluster.servers[1].host", ""))
+		assert.Equal(t, "10.0.1.1", archaius.GetString("pool.servers[0].host", ""))
+		assert.True(t, archaius.Exist("cluster.servers[0].port"))
+		assert.False(t, archaius.Exist("cluster.servers[2].port"))
+	})
+	t.Run("override one element", func(t *testing.T) {
+		archaius.Set("cluster.servers.1.port", 9090)
+		archaius.Set("cluster.servers[2].host", "10.0.0.3")
+		archaius.Set("pool.servers.0.port", 9090)
+		assert.Equal(t, 9090, archaius.GetInt("cluster.servers[1].port", 0))
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c)
+		assert.NoError(t, err)
+		assert.Equal(t, []Server{{"10.0.0.1", 8080}, {"10.0.0.2", 9090}, {"10.0.0.3", 0}}, c.Cluster.Servers)
+		assert.Equal(t, []Server{{"10.0.1.1", 9090}}, c.Pool.Servers)
+	})
+}
+
+type batchListener struct {
+	events chan []*event.Event
+}
+
+func (l *batchListener) Event(events []*event.Event) {
+	l.events <- events
+}
+
+func TestSetStruct(t *testing.T) {
+	err := archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+
+	type Replica struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+	type DB struct {
+		Host     string        `yaml:"host"`
+		Timeout  time.Duration `yaml:"timeout"`
+		Replicas []Replica     `yaml:"replicas"`
+		Labels   map[string]string
+		Password string `yaml:"-"`
+	}
+	db := DB{
+		Host:     "10.0.0.1",
+		Timeout:  3 * time.Second,
+		Replicas: []Replica{{"10.0.0.2", 3306}, {"10.0.0.3", 3307}},
+		Labels:   map[string]string{"zone": "a"},
+		Password: "secret",
+	}
+
+	l := &batchListener{events: make(chan []*event.Event, 1)}
+	err = archaius.RegisterModuleListener(l, "reverse")
+	assert.NoError(t, err)
+	err = archaius.SetStruct("reverse.db", &db)
+	assert.NoError(t, err)
+
+	t.Run("one module event for the struct", func(t *testing.T) {
+		select {
+		case events := <-l.events:
+			assert.Equal(t, 4, len(events))
+		case <-time.After(3 * time.Second):
+			t.Fatal("no module event")
+		}
+	})
+	t.Run("keys made by tags", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.1", archaius.GetString("reverse.db.host", ""))
+		assert.Equal(t, "3s", archaius.GetString("reverse.db.timeout", ""))
+		assert.Equal(t, "a", archaius.GetString("reverse.db.labels.zone", ""))
+		assert.Equal(t, "10.0.0.3", archaius.GetString("reverse.db.replicas[1].host", ""))
+		assert.False(t, archaius.Exist("reverse.db.password"))
+	})
+	t.Run("unmarshal back", func(t *testing.T) {
+		c := &struct {
+			Reverse struct {
+				DB DB `yaml:"db"`
+			} `yaml:"reverse"`
+		}{}
+		err := archaius.UnmarshalConfig(c)
+		assert.NoError(t, err)
+		db.Password = ""
+		assert.Equal(t, db, c.Reverse.DB)
+	})
+	t.Run("invalid object", func(t *testing.T) {
+		err := archaius.SetStruct("reverse", "text")
+		assert.Equal(t, source.ErrObjectInvalid, err)
+	})
+}
+
+func TestDefaultsFrom(t *testing.T) {
+	b := []byte(`
+server:
+  port: 9090
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "defaults.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	type Server struct {
+		Host    string        `yaml:"host"`
+		Port    int           `yaml:"port"`
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	type Config struct {
+		Server Server `yaml:"server"`
+	}
+	err = archaius.DefaultsFrom(&Config{Server: Server{Host: "0.0.0.0", Port: 8080, Timeout: time.Second}})
+	assert.NoError(t, err)
+
+	t.Run("defaults are overridden by other sources", func(t *testing.T) {
+		assert.Equal(t, 9090, archaius.GetInt("server.port", 0))
+		assert.Equal(t, "0.0.0.0", archaius.GetString("server.host", ""))
+		archaius.Set("server.host", "127.0.0.1")
+		assert.Equal(t, "127.0.0.1", archaius.GetString("server.host", ""))
+		archaius.Delete("server.host")
+		assert.Equal(t, "0.0.0.0", archaius.GetString("server.host", ""))
+	})
+	t.Run("merge defaults", func(t *testing.T) {
+		err := archaius.DefaultsFrom(map[string]interface{}{"server": map[string]interface{}{"name": "api"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "api", archaius.GetString("server.name", ""))
+		assert.Equal(t, "0.0.0.0", archaius.GetString("server.host", ""))
+	})
+	t.Run("unmarshal with defaults", func(t *testing.T) {
+		c := &Config{}
+		err := archaius.UnmarshalConfig(c)
+		assert.NoError(t, err)
+		assert.Equal(t, Server{Host: "0.0.0.0", Port: 9090, Timeout: time.Second}, c.Server)
+	})
+	t.Run("defaults with lower case keys", func(t *testing.T) {
+		archaius.Clean()
+		defer archaius.Clean()
+		err := archaius.Init(archaius.WithLowerCaseKeys())
+		assert.NoError(t, err)
+		err = archaius.DefaultsFrom(map[string]interface{}{"Server": map[string]interface{}{"Host": "0.0.0.0"}})
+		assert.NoError(t, err)
+		err = archaius.DefaultsFrom(map[string]interface{}{"Server": map[string]interface{}{"Name": "api"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "0.0.0.0", archaius.GetString("server.host", ""))
+		assert.Equal(t, "api", archaius.GetString("server.name", ""))
+		assert.ElementsMatch(t, []string{"server.host", "server.name"}, archaius.Keys("server.*"))
+	})
+}
+
+type refListener struct {
+	events chan *event.Event
+}
+
+func (l *refListener) Event(e *event.Event) {
+	l.events <- e
+}
+
+func TestReferences(t *testing.T) {
+	b := []byte(`
+ref:
+  db:
+    host: 10.0.0.1
+    port: 3306
+  url: http://${ref.db.host}:${ref.db.port}/app
+  port: ${ref.db.port}
+  dsn: ${ref.url}?timeout=3s
+  cycle:
+    a: ${ref.cycle.b}
+    b: x-${ref.cycle.a}
+  missing: ${ref.not.exist}
+  env: ${REF_ENV||default}
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "references.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	t.Run("resolve references", func(t *testing.T) {
+		assert.Equal(t, "http://10.0.0.1:3306/app", archaius.GetString("ref.url", ""))
+		assert.Equal(t, 3306, archaius.Get("ref.port"))
+		assert.Equal(t, "http://10.0.0.1:3306/app?timeout=3s", archaius.GetString("ref.dsn", ""))
+		assert.Equal(t, "default", archaius.GetString("ref.env", ""))
+		assert.Equal(t, "http://10.0.0.1:3306/app", archaius.GetConfigs()["ref.url"])
+	})
+	t.Run("cycle and unresolved references", func(t *testing.T) {
+		_, err := archaius.GetValue("ref.cycle.a").ToString()
+		assert.True(t, errors.Is(err, source.ErrReferenceCycle))
+		assert.Contains(t, err.Error(), "ref.cycle.a -> ref.cycle.b -> ref.cycle.a")
+		_, err = archaius.GetValue("ref.missing").ToString()
+		assert.True(t, errors.Is(err, source.ErrReferenceUnresolved))
+		assert.Equal(t, "${ref.not.exist}", archaius.Get("ref.missing"))
+	})
+	t.Run("dependents get change events", func(t *testing.T) {
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err := archaius.RegisterListener(l, "ref.url", "ref.dsn")
+		assert.NoError(t, err)
+		defer archaius.UnRegisterListener(l, "ref.url", "ref.dsn")
+		err = archaius.Set("ref.db.host", "10.0.0.2")
+		assert.NoError(t, err)
+		got := make(map[string]interface{})
+		for len(got) < 2 {
+			select {
+			case e := <-l.events:
+				got[e.Key] = e.Value
+			case <-time.After(3 * time.Second):
+				t.Fatal("no event of dependents")
+			}
+		}
+		assert.Equal(t, "http://10.0.0.2:3306/app", got["ref.url"])
+		assert.Equal(t, "http://10.0.0.2:3306/app?timeout=3s", got["ref.dsn"])
+		assert.Equal(t, "http://10.0.0.2:3306/app", archaius.GetString("ref.url", ""))
+	})
+	t.Run("a key no longer referencing gets no change event", func(t *testing.T) {
+		err := archaius.Set("ref.port", "8080")
+		assert.NoError(t, err)
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err = archaius.RegisterListener(l, "ref.port", "ref.url")
+		assert.NoError(t, err)
+		defer archaius.UnRegisterListener(l, "ref.port", "ref.url")
+		err = archaius.Set("ref.db.port", 3307)
+		assert.NoError(t, err)
+		select {
+		case e := <-l.events:
+			assert.Equal(t, "ref.url", e.Key)
+			assert.Equal(t, "http://10.0.0.2:3307/app", e.Value)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event of dependents")
+		}
+		select {
+		case e := <-l.events:
+			t.Fatalf("unexpected event of %s", e.Key)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestValueTransformers(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	os.Setenv("TR_NAME", "  from env  ")
+	defer os.Unsetenv("TR_NAME")
+	os.Setenv("TR_HOST", "db.local")
+	defer os.Unsetenv("TR_HOST")
+
+	calls := 0
+	upper := func(key string, v interface{}, src string) (interface{}, error) {
+		if key != "tr.upper" {
+			return v, nil
+		}
+		calls++
+		return strings.ToUpper(v.(string)) + "@" + src, nil
+	}
+	err = archaius.Init(archaius.WithENVSource(), archaius.WithMemorySource(),
+		archaius.WithValueTransformers(archaius.ExpandEnv(), archaius.TrimSpace(), upper))
+	assert.NoError(t, err)
+
+	t.Run("transform values of all sources", func(t *testing.T) {
+		assert.Equal(t, "from env", archaius.GetString("TR_NAME", ""))
+		archaius.Set("tr.addr", " http://${TR_HOST||localhost}:8080 ")
+		assert.Equal(t, "http://db.local:8080", archaius.GetString("tr.addr", ""))
+		assert.Equal(t, "http://db.local:8080", archaius.GetConfigs()["tr.addr"])
+	})
+	t.Run("transformed value is cached", func(t *testing.T) {
+		archaius.Set("tr.upper", "abc")
+		calls = 0
+		assert.Equal(t, "ABC@MemorySource", archaius.Get("tr.upper"))
+		assert.Equal(t, "ABC@MemorySource", archaius.Get("tr.upper"))
+		assert.Equal(t, 0, calls)
+		archaius.Set("tr.upper", "def")
+		assert.Equal(t, "DEF@MemorySource", archaius.Get("tr.upper"))
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("events carry transformed values", func(t *testing.T) {
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err := archaius.RegisterListener(l, "tr.name")
+		assert.NoError(t, err)
+		archaius.Set("tr.name", "  ${TR_HOST||localhost}  ")
+		select {
+		case e := <-l.events:
+			assert.Equal(t, "db.local", e.Value)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event")
+		}
+	})
+}
+
+func TestEncryptedValues(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	c, err := cipher.NewAESGCM([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	password, err := cipher.EncryptValue(c, "s3cret")
+	assert.NoError(t, err)
+	b := []byte(`
+enc:
+  db:
+    user: root
+    password: ` + password + `
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "encrypted.yaml")
+	err = os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithCipher(c))
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	t.Run("reads return plain text", func(t *testing.T) {
+		assert.Equal(t, "s3cret", archaius.GetString("enc.db.password", ""))
+		s, err := archaius.GetValue("enc.db.password").ToString()
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", s)
+		conf := &struct {
+			Enc struct {
+				DB struct {
+					User     string `yaml:"user"`
+					Password string `yaml:"password"`
+				} `yaml:"db"`
+			} `yaml:"enc"`
+		}{}
+		err = archaius.UnmarshalConfig(conf)
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", conf.Enc.DB.Password)
+	})
+	t.Run("dumps keep cipher text", func(t *testing.T) {
+		assert.Equal(t, password, archaius.GetConfigs()["enc.db.password"])
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf)
+		assert.NoError(t, err)
+		assert.NotContains(t, buf.String(), "s3cret")
+	})
+	t.Run("events keep cipher text", func(t *testing.T) {
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err := archaius.RegisterListener(l, "enc.token")
+		assert.NoError(t, err)
+		token, err := cipher.EncryptValue(c, "t0ken")
+		assert.NoError(t, err)
+		archaius.Set("enc.token", token)
+		select {
+		case e := <-l.events:
+			assert.Equal(t, token, e.Value)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event")
+		}
+		assert.Equal(t, "t0ken", archaius.Get("enc.token"))
+	})
+	t.Run("invalid cipher text", func(t *testing.T) {
+		archaius.Set("enc.broken", "ENC(bm90IGVuY3J5cHRlZA==)")
+		_, err := archaius.GetValue("enc.broken").ToString()
+		assert.ErrorIs(t, err, cipher.ErrInvalidCipherText)
+		assert.Equal(t, "ENC(bm90IGVuY3J5cHRlZA==)", archaius.Get("enc.broken"))
+	})
+}
+
+func TestSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_pass")
+	err := os.WriteFile(secret, []byte("s3cret\n"), 0600)
+	assert.NoError(t, err)
+	t.Setenv("SECRET_TEST_USER", "admin")
+
+	archaius.Clean()
+	defer archaius.Clean()
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	archaius.RegisterSecretResolver("test", source.SecretResolverFunc(func(ref string) (string, error) {
+		return strings.ToUpper(ref), nil
+	}))
+	defer archaius.UnRegisterSecretResolver("test")
+	archaius.Set("secret.password", "${file:"+secret+"}")
+	archaius.Set("secret.dsn", "${env:SECRET_TEST_USER}:${file:"+secret+"}@${test:db}")
+	archaius.Set("secret.missing", "${env:SECRET_TEST_NOT_EXIST}")
+
+	t.Run("resolve secrets on read", func(t *testing.T) {
+		assert.Equal(t, "s3cret", archaius.GetString("secret.password", ""))
+		assert.Equal(t, "admin:s3cret@DB", archaius.GetString("secret.dsn", ""))
+		assert.Equal(t, "${file:"+secret+"}", archaius.GetConfigs()["secret.password"])
+		_, err := archaius.GetValue("secret.missing").ToString()
+		assert.ErrorIs(t, err, source.ErrSecretUnresolved)
+	})
+	t.Run("exec resolver", func(t *testing.T) {
+		archaius.RegisterSecretResolver("exec", source.ExecSecretResolver(3*time.Second))
+		defer archaius.UnRegisterSecretResolver("exec")
+		archaius.Set("secret.exec", "${exec:echo hello}")
+		assert.Equal(t, "hello", archaius.GetString("secret.exec", ""))
+	})
+	t.Run("refresh when the secret file changes", func(t *testing.T) {
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err := archaius.RegisterListener(l, "secret.password")
+		assert.NoError(t, err)
+		defer archaius.UnRegisterListener(l, "secret.password")
+		err = os.WriteFile(secret, []byte("n3w"), 0600)
+		assert.NoError(t, err)
+		select {
+		case e := <-l.events:
+			assert.Equal(t, "secret.password", e.Key)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event of changed secret")
+		}
+		assert.Equal(t, "n3w", archaius.GetString("secret.password", ""))
+	})
+}
+
+func TestSensitiveKeys(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	b := []byte(`
+sensitive:
+  db:
+    host: 10.0.0.1
+    password: s3cret
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "sensitive.yaml")
+	err = os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithSensitiveKeys("*password*"))
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	l := &refListener{events: make(chan *event.Event, 10)}
+	err = archaius.RegisterListener(l, "sensitive.api.token")
+	assert.NoError(t, err)
+	err = archaius.Set("sensitive.api.token", "t0ken", archaius.Sensitive())
+	assert.NoError(t, err)
+
+	t.Run("get returns the real value", func(t *testing.T) {
+		assert.Equal(t, "s3cret", archaius.GetString("sensitive.db.password", ""))
+		assert.Equal(t, "t0ken", archaius.GetString("sensitive.api.token", ""))
+	})
+	t.Run("dumps are masked", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf)
+		assert.NoError(t, err)
+		assert.NotContains(t, buf.String(), "s3cret")
+		assert.NotContains(t, buf.String(), "t0ken")
+		assert.Contains(t, buf.String(), "10.0.0.1")
+		c := archaius.GetConfigsWithSourceNames()
+		assert.Equal(t, redact.Mask, c["sensitive.db.password"].(map[string]interface{})["value"])
+		assert.Equal(t, "10.0.0.1", c["sensitive.db.host"].(map[string]interface{})["value"])
+	})
+	t.Run("event string is masked", func(t *testing.T) {
+		select {
+		case e := <-l.events:
+			assert.Equal(t, "t0ken", e.Value)
+			assert.NotContains(t, e.String(), "t0ken")
+			assert.NotContains(t, fmt.Sprintf("%v", []*event.Event{e}), "t0ken")
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event")
+		}
+	})
+	t.Run("a key referencing a sensitive key", func(t *testing.T) {
+		err := archaius.Set("sensitive.db.url", "postgres://u:${sensitive.db.password}@h")
+		assert.NoError(t, err)
+		assert.Equal(t, "postgres://u:s3cret@h", archaius.GetString("sensitive.db.url", ""))
+		// the references are kept where the values are not masked
+		assert.Equal(t, "postgres://u:${sensitive.db.password}@h", archaius.GetConfigs()["sensitive.db.url"])
+
+		dl := &refListener{events: make(chan *event.Event, 10)}
+		err = archaius.RegisterListener(dl, "sensitive.db.url")
+		assert.NoError(t, err)
+		defer archaius.UnRegisterListener(dl, "sensitive.db.url")
+		err = archaius.Set("sensitive.db.password", "newpass")
+		assert.NoError(t, err)
+		select {
+		case e := <-dl.events:
+			assert.Equal(t, "sensitive.db.url", e.Key)
+			assert.Equal(t, "postgres://u:newpass@h", e.Value)
+			assert.True(t, e.Sensitive)
+			assert.Contains(t, e.String(), "Value:"+redact.Mask)
+			assert.NotContains(t, e.String(), "newpass")
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event of the referencing key")
+		}
+	})
+}
+
+func TestWriteToReferencingSensitiveKey(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithSensitiveKeys("*password*"))
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.password", "hunter2")
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.dsn", "${out.db.url}")
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.url", "postgres://u:${out.db.password}@h")
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.host", "h")
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.addr", "${out.db.host}:5432")
+	assert.NoError(t, err)
+
+	for _, view := range []archaius.ConfigView{archaius.PerSource, archaius.Merged, archaius.WithProvenance} {
+		t.Run(string(view), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := archaius.WriteTo(buf, archaius.Format(archaius.Properties), archaius.View(view))
+			assert.NoError(t, err)
+			assert.NotContains(t, buf.String(), "hunter2")
+			assert.Contains(t, buf.String(), "out.db.url=postgres://u:${out.db.password}@h\n")
+			assert.Contains(t, buf.String(), "out.db.dsn=${out.db.url}\n")
+			assert.Contains(t, buf.String(), "out.db.password="+redact.Mask+"\n")
+		})
+	}
+	t.Run("other references are resolved", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf, archaius.Format(archaius.Properties), archaius.View(archaius.Merged))
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), "out.db.addr=h:5432\n")
+	})
+}
+
+func TestSensitiveKeysOfManager(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithLowerCaseKeys())
+	assert.NoError(t, err)
+	err = archaius.Set("Sensitive.API.Secret", "s3cret", archaius.Sensitive())
+	assert.NoError(t, err)
+
+	t.Run("the canonical key is sensitive", func(t *testing.T) {
+		assert.Equal(t, "s3cret", archaius.GetString("sensitive.api.secret", ""))
+		c := archaius.GetConfigsWithSourceNames()
+		assert.Equal(t, redact.Mask, c["sensitive.api.secret"].(map[string]interface{})["value"])
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf)
+		assert.NoError(t, err)
+		assert.NotContains(t, buf.String(), "s3cret")
+	})
+	t.Run("a new manager has no sensitive keys of the old one", func(t *testing.T) {
+		err := archaius.Clean()
+		assert.NoError(t, err)
+		err = archaius.Init(archaius.WithMemorySource())
+		assert.NoError(t, err)
+		err = archaius.Set("sensitive.api.secret", "s3cret")
+		assert.NoError(t, err)
+		c := archaius.GetConfigsWithSourceNames()
+		assert.Equal(t, "s3cret", c["sensitive.api.secret"].(map[string]interface{})["value"])
+	})
+}
+
+func TestWriteToFormats(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	b := []byte(`
+out:
+  db:
+    host: 10.0.0.1
+    port: 3306
+  tags:
+    - a
+    - b c
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "write_to.yaml")
+	err = os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+	err = archaius.Set("out.db.host", "10.0.0.2")
+	assert.NoError(t, err)
+
+	write := func(opts ...archaius.WriteOption) string {
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf, opts...)
+		assert.NoError(t, err)
+		return buf.String()
+	}
+	t.Run("merged json", func(t *testing.T) {
+		var doc map[string]interface{}
+		err := json.Unmarshal([]byte(write(archaius.Format(archaius.JSON), archaius.View(archaius.Merged))), &doc)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"out": map[string]interface{}{
+				"db":   map[string]interface{}{"host": "10.0.0.2", "port": float64(3306)},
+				"tags": []interface{}{"a", "b c"},
+			},
+		}, doc)
+	})
+	t.Run("merged yaml", func(t *testing.T) {
+		s := write(archaius.View(archaius.Merged))
+		assert.Contains(t, s, "out:\n    db:\n        host: 10.0.0.2\n")
+	})
+	t.Run("per source yaml", func(t *testing.T) {
+		s := write()
+		assert.Contains(t, s, "FileSource:\n")
+		assert.Contains(t, s, "MemorySource:\n    out.db.host: 10.0.0.2\n")
+	})
+	t.Run("with provenance json", func(t *testing.T) {
+		var doc map[string]map[string]interface{}
+		err := json.Unmarshal([]byte(write(archaius.Format(archaius.JSON), archaius.View(archaius.WithProvenance))), &doc)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"value": "10.0.0.2", "source": "MemorySource"}, doc["out.db.host"])
+		assert.Equal(t, "FileSource", doc["out.db.port"]["source"])
+	})
+	t.Run("merged toml", func(t *testing.T) {
+		s := write(archaius.Format(archaius.TOML), archaius.View(archaius.Merged))
+		assert.Equal(t, "[out]\ntags = [\"a\", \"b c\"]\n[out.db]\nhost = \"10.0.0.2\"\nport = 3306\n", s)
+	})
+	t.Run("merged properties", func(t *testing.T) {
+		s := write(archaius.Format(archaius.Properties), archaius.View(archaius.Merged))
+		assert.Equal(t, "out.db.host=10.0.0.2\nout.db.port=3306\nout.tags.0=a\nout.tags.1=b c\n", s)
+	})
+	t.Run("merged dotenv", func(t *testing.T) {
+		s := write(archaius.Format(archaius.Dotenv), archaius.View(archaius.Merged))
+		assert.Equal(t, "OUT_DB_HOST=10.0.0.2\nOUT_DB_PORT=3306\nOUT_TAGS_0=a\nOUT_TAGS_1=\"b c\"\n", s)
+	})
+	t.Run("properties with provenance", func(t *testing.T) {
+		s := write(archaius.Format(archaius.Properties), archaius.View(archaius.WithProvenance))
+		assert.Contains(t, s, "# source: MemorySource\nout.db.host=10.0.0.2\n")
+		assert.Contains(t, s, "# source: FileSource\nout.tags.1=b c\n")
+	})
+	t.Run("invalid format", func(t *testing.T) {
+		err := archaius.WriteTo(&bytes.Buffer{}, archaius.Format("xml"))
+		assert.ErrorIs(t, err, source.ErrFormatInvalid)
+	})
+}
+
+func TestWriteToResolvedWithSeparator(t *testing.T) {
+	err := archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithKeySeparator("/"))
+	assert.NoError(t, err)
+	err = archaius.Set("out/db/host", "10.0.0.1")
+	assert.NoError(t, err)
+	err = archaius.Set("out/db/url", "mysql://${out/db/host}:3306")
+	assert.NoError(t, err)
+	err = archaius.Set("out/tags", []interface{}{"a", "b"})
+	assert.NoError(t, err)
+
+	write := func(opts ...archaius.WriteOption) string {
+		buf := &bytes.Buffer{}
+		err := archaius.WriteTo(buf, opts...)
+		assert.NoError(t, err)
+		return buf.String()
+	}
+	t.Run("provenance resolves references like the merged view", func(t *testing.T) {
+		var doc map[string]map[string]interface{}
+		err := json.Unmarshal([]byte(write(archaius.Format(archaius.JSON), archaius.View(archaius.WithProvenance))), &doc)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"value": "mysql://10.0.0.1:3306", "source": "MemorySource"}, doc["out/db/url"])
+	})
+	t.Run("properties are flattened by the separator", func(t *testing.T) {
+		s := write(archaius.Format(archaius.Properties), archaius.View(archaius.WithProvenance))
+		assert.Equal(t, "# source: MemorySource\nout/db/host=10.0.0.1\n"+
+			"# source: MemorySource\nout/db/url=mysql://10.0.0.1:3306\n"+
+			"# source: MemorySource\nout/tags/0=a\n# source: MemorySource\nout/tags/1=b\n", s)
+	})
+	t.Run("merged toml", func(t *testing.T) {
+		s := write(archaius.Format(archaius.TOML), archaius.View(archaius.Merged))
+		assert.Equal(t, "[out]\ntags = [\"a\", \"b\"]\n[out.db]\nhost = \"10.0.0.1\"\nurl = \"mysql://10.0.0.1:3306\"\n", s)
+	})
+}
+
+func TestSub(t *testing.T) {
+	b := []byte(`
+redis:
+  addr: 127.0.0.1:6379
+  timeout: 3s
+  pool:
+    size: 10
+redisx:
+  addr: 10.0.0.1:6379
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "sub.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	redis := archaius.Sub("redis")
+	t.Run("read relative keys", func(t *testing.T) {
+		assert.Equal(t, "127.0.0.1:6379", redis.GetString("addr", ""))
+		assert.Equal(t, 10, redis.Sub("pool").GetInt("size", 0))
+		assert.True(t, redis.Exist("timeout"))
+		assert.False(t, redis.Exist("redisx.addr"))
+		assert.Equal(t, []string{"addr", "pool.size", "timeout"}, redis.Keys())
+	})
+	t.Run("unmarshal relative keys", func(t *testing.T) {
+		c := &struct {
+			Addr    string        `yaml:"addr"`
+			Timeout time.Duration `yaml:"timeout"`
+		}{}
+		err := redis.UnmarshalConfig(c)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:6379", c.Addr)
+		assert.Equal(t, 3*time.Second, c.Timeout)
+	})
+	t.Run("listen relative keys", func(t *testing.T) {
+		l := &refListener{events: make(chan *event.Event, 10)}
+		err := redis.RegisterListener(l, "addr")
+		assert.NoError(t, err)
+		ml := &batchListener{events: make(chan []*event.Event, 10)}
+		err = redis.RegisterModuleListener(ml)
+		assert.NoError(t, err)
+
+		archaius.Set("redisx.addr", "10.0.0.2:6379")
+		archaius.Set("other.addr", "10.0.0.3:6379")
+		archaius.Set("redis.addr", "10.0.0.4:6379")
+		select {
+		case e := <-l.events:
+			assert.Equal(t, "addr", e.Key)
+			assert.Equal(t, "10.0.0.4:6379", e.Value)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event")
+		}
+		select {
+		case events := <-ml.events:
+			assert.Equal(t, 1, len(events))
+			assert.Equal(t, "addr", events[0].Key)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no module event")
+		}
+		assert.Equal(t, "10.0.0.4:6379", redis.GetString("addr", ""))
+
+		err = redis.UnRegisterListener(l, "addr")
+		assert.NoError(t, err)
+		err = redis.UnRegisterModuleListener(ml)
+		assert.NoError(t, err)
+		archaius.Set("redis.addr", "10.0.0.5:6379")
+		select {
+		case e := <-l.events:
+			t.Fatalf("unexpected event %s", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+		assert.Equal(t, 0, len(l.events))
+		assert.Equal(t, 0, len(ml.events))
+	})
+}
+
+func TestKeyQueries(t *testing.T) {
+	b := []byte(`
+query:
+  redis:
+    addr: 127.0.0.1:6379
+    timeout: 3s
+    pool:
+      size: 10
+  redisx:
+    addr: 10.0.0.1:6379
+  db:
+    timeout: 5s
+`)
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "query.yaml")
+	err := os.WriteFile(filename, b, 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(filename)
+	assert.NoError(t, err)
+
+	t.Run("keys by pattern", func(t *testing.T) {
+		assert.Equal(t, []string{"query.redis.addr", "query.redis.pool.size", "query.redis.timeout"}, archaius.Keys("query.redis.*"))
+		assert.Equal(t, []string{"query.db.timeout", "query.redis.timeout"}, archaius.Keys("query.*.timeout"))
+		assert.Equal(t, []string{"query.redisx.addr"}, archaius.Keys("query.redisx.addr"))
+		assert.Equal(t, []string{}, archaius.Keys("query.none.*"))
+	})
+	t.Run("get by prefix", func(t *testing.T) {
+		assert.Equal(t, map[string]interface{}{
+			"query.redis.addr":      "127.0.0.1:6379",
+			"query.redis.timeout":   "3s",
+			"query.redis.pool.size": 10,
+		}, archaius.GetByPrefix("query.redis"))
+	})
+	t.Run("get tree", func(t *testing.T) {
+		assert.Equal(t, map[string]interface{}{
+			"addr":    "127.0.0.1:6379",
+			"timeout": "3s",
+			"pool":    map[string]interface{}{"size": 10},
+		}, archaius.GetTree("query.redis"))
+	})
+	t.Run("index follows changes", func(t *testing.T) {
+		archaius.Set("query.redis.db", 1)
+		assert.Contains(t, archaius.Keys("query.redis.*"), "query.redis.db")
+		assert.Equal(t, 1, archaius.GetTree("query.redis")["db"])
+	})
+}
+
+func TestKeyNormalization(t *testing.T) {
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "normalization.yaml")
+	err := os.WriteFile(filename, []byte(`
+App:
+  DB:
+    port: 3306
+redis:
+  addr: 127.0.0.1:6379
+  pool:
+    size: 10
+  url: redis://${redis/addr}
+`), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+
+	t.Run("lower case keys", func(t *testing.T) {
+		t.Setenv("APP_DB_HOST", "10.0.0.1")
+		err := archaius.Clean()
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		err = archaius.Init(archaius.WithENVSource(), archaius.WithMemorySource(),
+			archaius.WithRequiredFiles([]string{filename}), archaius.WithLowerCaseKeys())
+		assert.NoError(t, err)
+
+		assert.Equal(t, "10.0.0.1", archaius.GetString("app.db.host", ""))
+		assert.Equal(t, "10.0.0.1", archaius.GetString("APP.DB.HOST", ""))
+		assert.Equal(t, 3306, archaius.GetInt("app.db.port", 0))
+		assert.True(t, archaius.Exist("App.Db.Port"))
+		assert.Equal(t, []string{"app.db.host", "app.db.port"}, archaius.Keys("app.db.*"))
+
+		err = archaius.Set("App.Mode", "debug")
+		assert.NoError(t, err)
+		assert.Equal(t, "debug", archaius.GetString("app.mode", ""))
+
+		type db struct {
+			Host string `yaml:"host"`
+			Port int    `yaml:"port"`
+		}
+		c := struct {
+			DB db `yaml:"DB"`
+		}{}
+		err = archaius.UnmarshalConfig(&c, archaius.TagName("yaml"), source.WithPrefix("App"))
+		assert.NoError(t, err)
+		assert.Equal(t, db{Host: "10.0.0.1", Port: 3306}, c.DB)
+	})
+	t.Run("untagged fields with lower case keys", func(t *testing.T) {
+		err := archaius.Clean()
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		err = archaius.Init(archaius.WithMemorySource(), archaius.WithLowerCaseKeys())
+		assert.NoError(t, err)
+		err = archaius.Set("pool.max_conns", 7)
+		assert.NoError(t, err)
+		err = archaius.Set("pool.IdleConns", 3)
+		assert.NoError(t, err)
+
+		c := struct {
+			Pool struct {
+				MaxConns  int
+				IdleConns int
+			}
+		}{}
+		err = archaius.UnmarshalConfig(&c)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, c.Pool.MaxConns)
+		assert.Equal(t, 3, c.Pool.IdleConns)
+	})
+	t.Run("separator", func(t *testing.T) {
+		err := archaius.Clean()
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		err = archaius.Init(archaius.WithMemorySource(),
+			archaius.WithRequiredFiles([]string{filename}), archaius.WithKeySeparator("/"))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "127.0.0.1:6379", archaius.GetString("redis/addr", ""))
+		assert.False(t, archaius.Exist("redis.addr"))
+		assert.Equal(t, "redis://127.0.0.1:6379", archaius.GetString("redis/url", ""))
+		assert.Equal(t, []string{"redis/pool/size"}, archaius.Keys("redis/pool/*"))
+		assert.Equal(t, map[string]interface{}{"size": 10}, archaius.GetTree("redis")["pool"])
+		assert.Equal(t, 10, archaius.Sub("redis").GetInt("pool/size", 0))
+
+		c := struct {
+			Addr string `yaml:"addr"`
+			Pool struct {
+				Size int `yaml:"size"`
+			} `yaml:"pool"`
+		}{}
+		err = archaius.UnmarshalConfig(&c, archaius.TagName("yaml"), source.WithPrefix("redis"))
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:6379", c.Addr)
+		assert.Equal(t, 10, c.Pool.Size)
+	})
+	t.Run("source normalizer", func(t *testing.T) {
+		t.Setenv("MYAPP__CACHE__TTL", "30s")
+		err := archaius.Clean()
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		err = archaius.Init(archaius.WithENVSource(), archaius.WithLowerCaseKeys(),
+			archaius.WithSourceKeyNormalizer(env.Name, func(key string) string {
+				return strings.ReplaceAll(strings.TrimPrefix(key, "MYAPP__"), "__", ".")
+			}))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "30s", archaius.GetString("cache.ttl", ""))
+	})
+}
+
+func TestRegisterAlias(t *testing.T) {
+	d, _ := os.Getwd()
+	filename := filepath.Join(d, "alias.yaml")
+	err := os.WriteFile(filename, []byte(`
+legacy:
+  db:
+    host: 10.0.0.1
+`), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(filename)
+	err = archaius.Clean()
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	err = archaius.Init(archaius.WithMemorySource(), archaius.WithRequiredFiles([]string{filename}))
+	assert.NoError(t, err)
+
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	err = archaius.RegisterAlias("legacy.db.host", "alias.db.host", archaius.Deprecated("use alias.db.host instead"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, archaius.RegisterAlias("alias.db.port", "alias.db.port"), source.ErrAliasInvalid)
+	assert.ErrorIs(t, archaius.RegisterAlias("legacy.db.host", "other.db.host"), source.ErrAliasInvalid)
+	assert.ErrorIs(t, archaius.RegisterAlias("older.db.host", "legacy.db.host"), source.ErrAliasInvalid)
+
+	t.Run("reads resolve to the same value", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.1", archaius.GetString("alias.db.host", ""))
+		assert.Equal(t, "10.0.0.1", archaius.GetString("legacy.db.host", ""))
+		assert.True(t, archaius.Exist("alias.db.host"))
+	})
+	t.Run("deprecation is warned once", func(t *testing.T) {
+		err := archaius.AddFile(filename)
+		assert.NoError(t, err)
+		warnings := 0
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, "legacy.db.host") && strings.Contains(entry.Message, "deprecated") {
+				assert.Contains(t, entry.Message, "use alias.db.host instead")
+				warnings++
+			}
+		}
+		assert.Equal(t, 1, warnings)
+	})
+	t.Run("events fire for both names", func(t *testing.T) {
+		newListener := &refListener{events: make(chan *event.Event, 10)}
+		oldListener := &refListener{events: make(chan *event.Event, 10)}
+		assert.NoError(t, archaius.RegisterListener(newListener, "^alias.db.host$"))
+		assert.NoError(t, archaius.RegisterListener(oldListener, "^legacy.db.host$"))
+
+		err := archaius.Set("legacy.db.host", "10.0.0.2")
+		assert.NoError(t, err)
+		for _, l := range []*refListener{newListener, oldListener} {
+			select {
+			case e := <-l.events:
+				assert.Equal(t, "10.0.0.2", e.Value)
+			case <-time.After(3 * time.Second):
+				t.Fatal("no event")
+			}
+		}
+		assert.Equal(t, "10.0.0.2", archaius.GetString("alias.db.host", ""))
+
+		err = archaius.Set("alias.db.host", "10.0.0.3")
+		assert.NoError(t, err)
+		for _, l := range []*refListener{newListener, oldListener} {
+			select {
+			case e := <-l.events:
+				assert.Equal(t, "10.0.0.3", e.Value)
+			case <-time.After(3 * time.Second):
+				t.Fatal("no event")
+			}
+		}
+		assert.Equal(t, "10.0.0.3", archaius.GetString("legacy.db.host", ""))
+	})
+}
+
+func TestFileFormats(t *testing.T) {
+	d, _ := os.Getwd()
+	dir := filepath.Join(d, "formats")
+	err := os.MkdirAll(dir, 0700)
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"app.json":       `{"formats": {"json": {"port": 8080}}}`,
+		"app.properties": "formats.properties.name = props",
+		"app.ini":        "[formats.ini]\nname = ini",
+		"app.toml":       "[formats.toml]\nname = \"toml\"\nsizes = [1, 2]",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.NoError(t, err)
+	}
+	err = archaius.Init(archaius.WithMemorySource())
+	assert.NoError(t, err)
+	err = archaius.AddFile(dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 8080, archaius.GetInt("formats.json.port", 0))
+	assert.Equal(t, "props", archaius.GetString("formats.properties.name", ""))
+	assert.Equal(t, "ini", archaius.GetString("formats.ini.name", ""))
+	assert.Equal(t, "toml", archaius.GetString("formats.toml.name", ""))
+	assert.Equal(t, []interface{}{1, 2}, archaius.Get("formats.toml.sizes"))
+
+	t.Run("reload by the handler of the extension", func(t *testing.T) {
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+		err := os.WriteFile(filepath.Join(dir, "app.toml"), []byte("[formats.toml]\nname = \"reloaded\""), 0600)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return archaius.GetString("formats.toml.name", "") == "reloaded"
+		}, 3*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	d, _ := os.Getwd()
+	dir := filepath.Join(d, "profiles")
+	err := os.MkdirAll(dir, 0700)
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"app.yaml":      "profile:\n  name: base\n  db: base\n  region: base\n",
+		"app-prod.yaml": "profile:\n  db: prod\n  region: prod\n",
+		"app-eu.yaml":   "profile:\n  region: eu\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.NoError(t, err)
+	}
+
+	archaius.Clean()
+	defer archaius.Clean()
+	err = archaius.Init(archaius.WithRequiredFiles([]string{filepath.Join(dir, "app.yaml")}),
+		archaius.WithProfiles("prod", "eu"), archaius.WithENVSource())
+	assert.NoError(t, err)
+	assert.Equal(t, "base", archaius.GetString("profile.name", ""))
+	assert.Equal(t, "prod", archaius.GetString("profile.db", ""))
+	assert.Equal(t, "eu", archaius.GetString("profile.region", ""))
+
+	e, err := archaius.Explain("profile.region")
+	assert.NoError(t, err)
+	assert.Equal(t, "eu", e.Value)
+	assert.Equal(t, filesource.FileConfigSourceConst, e.Source)
+	assert.Equal(t, filepath.Join(dir, "app-eu.yaml"), e.Origin)
+	assert.Equal(t, "eu", e.Profile)
+	e, err = archaius.Explain("profile.name")
+	assert.NoError(t, err)
+	assert.Equal(t, "", e.Profile)
+	_, err = archaius.Explain("profile.none")
+	assert.Error(t, err)
+
+	t.Run("profiles from env", func(t *testing.T) {
+		os.Setenv(archaius.ProfilesEnv, "prod")
+		defer os.Unsetenv(archaius.ProfilesEnv)
+		archaius.Clean()
+		err = archaius.Init(archaius.WithRequiredFiles([]string{filepath.Join(dir, "app.yaml")}),
+			archaius.WithProfiles("prod", "eu"))
+		assert.NoError(t, err)
+		assert.Equal(t, "prod", archaius.GetString("profile.region", ""))
+		e, err := archaius.Explain("profile.region")
+		assert.NoError(t, err)
+		assert.Equal(t, "prod", e.Profile)
+	})
+	for name, args := range map[string][]string{
+		"profiles from argument with =":     {"--archaius.profiles=prod,eu"},
+		"profiles from argument with space": {"--archaius.profiles", "prod,eu"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			osArgs := os.Args
+			defer func() { os.Args = osArgs }()
+			os.Args = append([]string{osArgs[0]}, args...)
+			archaius.Clean()
+			err = archaius.Init(archaius.WithRequiredFiles([]string{filepath.Join(dir, "app.yaml")}),
+				archaius.WithProfiles("prod"))
+			assert.NoError(t, err)
+			assert.Equal(t, "prod", archaius.GetString("profile.db", ""))
+			assert.Equal(t, "eu", archaius.GetString("profile.region", ""))
+		})
+	}
+}
+
+func TestFilePriority(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"defaults.yaml": "layer:\n  name: defaults\n  db: defaults\n  region: defaults\n  zone: defaults\n",
+		"app.yaml":      "layer:\n  db: app\n  region: app\n",
+		"local.yaml":    "layer:\n  region: local\n",
+		"extra.yaml":    "layer:\n  zone: extra\n  db: extra\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.NoError(t, err)
+	}
+
+	archaius.Clean()
+	defer archaius.Clean()
+	err := archaius.Init(archaius.WithLayeredFiles(filepath.Join(dir, "defaults.yaml"),
+		filepath.Join(dir, "app.yaml"), filepath.Join(dir, "local.yaml")))
+	assert.NoError(t, err)
+	assert.Equal(t, "defaults", archaius.GetString("layer.name", ""))
+	assert.Equal(t, "app", archaius.GetString("layer.db", ""))
+	assert.Equal(t, "local", archaius.GetString("layer.region", ""))
+
+	// the priority of app.yaml, which keeps its values, over defaults.yaml
+	err = archaius.AddFile(filepath.Join(dir, "extra.yaml"), archaius.WithFilePriority(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "extra", archaius.GetString("layer.zone", ""))
+	assert.Equal(t, "app", archaius.GetString("layer.db", ""))
+	e, err := archaius.Explain("layer.zone")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "extra.yaml"), e.Origin)
+
+	t.Run("layered files with profiles", func(t *testing.T) {
+		err := os.WriteFile(filepath.Join(dir, "defaults-prod.yaml"), []byte("layer:\n  db: prod\n"), 0600)
+		assert.NoError(t, err)
+		archaius.Clean()
+		err = archaius.Init(archaius.WithLayeredFiles(filepath.Join(dir, "defaults.yaml"),
+			filepath.Join(dir, "app.yaml")), archaius.WithProfiles("prod"))
+		assert.NoError(t, err)
+		// the profile file of defaults.yaml does not override app.yaml
+		assert.Equal(t, "app", archaius.GetString("layer.db", ""))
+		// and ranks above defaults.yaml by layer only
+		assert.Equal(t, map[string]filesource.FileRank{
+			filepath.Join(dir, "defaults.yaml"):      {Priority: 2, Layer: 1},
+			filepath.Join(dir, "defaults-prod.yaml"): {Priority: 2, Layer: 0},
+			filepath.Join(dir, "app.yaml"):           {Priority: 1, Layer: 1},
+		}, archaius.FileRanks())
+	})
+}
+
+func TestNamedFileSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"defaults.yaml":  "NAMED_HOST: defaults\nNAMED_PORT: defaults\n",
+		"overrides.yaml": "NAMED_PORT: overrides\n",
+		"extra.yaml":     "NAMED_USER: extra\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.NoError(t, err)
+	}
+	t.Setenv("NAMED_HOST", "env")
+	t.Setenv("NAMED_PORT", "env")
+
+	archaius.Clean()
+	defer archaius.Clean()
+	err := archaius.Init(archaius.WithENVSource(),
+		archaius.WithNamedFileSource("defaults", defaults.Priority-1, filepath.Join(dir, "defaults.yaml")),
+		archaius.WithNamedFileSource("overrides", 0, filepath.Join(dir, "overrides.yaml")))
+	assert.NoError(t, err)
+	assert.Equal(t, "env", archaius.GetString("NAMED_HOST", ""))
+	assert.Equal(t, "overrides", archaius.GetString("NAMED_PORT", ""))
+	e, err := archaius.Explain("NAMED_PORT")
+	assert.NoError(t, err)
+	assert.Equal(t, "overrides", e.Source)
+	assert.Equal(t, filepath.Join(dir, "overrides.yaml"), e.Origin)
+
+	err = archaius.AddFile(filepath.Join(dir, "extra.yaml"), archaius.WithFileSourceName("defaults"))
+	assert.NoError(t, err)
+	assert.Equal(t, "extra", archaius.GetString("NAMED_USER", ""))
+	e, err = archaius.Explain("NAMED_USER")
+	assert.NoError(t, err)
+	assert.Equal(t, "defaults", e.Source)
+	err = archaius.AddFile(filepath.Join(dir, "extra.yaml"), archaius.WithFileSourceName("none"))
+	assert.Error(t, err)
+
+	t.Run("watch the files of each source", func(t *testing.T) {
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+		err := os.WriteFile(filepath.Join(dir, "overrides.yaml"), []byte("NAMED_PORT: changed\n"), 0600)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return archaius.GetString("NAMED_PORT", "") == "changed"
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("duplicate source name", func(t *testing.T) {
+		archaius.Clean()
+		err := archaius.Init(archaius.WithNamedFileSource(filesource.FileConfigSourceConst, 9,
+			filepath.Join(dir, "defaults.yaml")))
+		assert.Error(t, err)
+	})
+}
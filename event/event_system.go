@@ -23,9 +23,13 @@ package event
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/arielsrv/go-archaius/pkg/redact"
 	"github.com/sirupsen/logrus"
 )
 
@@ -34,6 +38,9 @@ var (
 	ErrNilListener = errors.New("nil listener")
 )
 
+// DefaultSeparator separates the parts of a key, like db.host.
+const DefaultSeparator = "."
+
 const (
 	Update = "UPDATE"
 	Delete = "DELETE"
@@ -43,10 +50,19 @@ const (
 type PrefixIndex struct {
 	Prefix    string
 	NextParts map[string]*PrefixIndex
+	// Separator splits the prefixes into parts, DefaultSeparator if empty
+	Separator string
+}
+
+func (pre *PrefixIndex) separator() string {
+	if pre.Separator == "" {
+		return DefaultSeparator
+	}
+	return pre.Separator
 }
 
 func (pre *PrefixIndex) AddPrefix(prefix string) {
-	parts := strings.Split(prefix, ".")
+	parts := strings.Split(prefix, pre.separator())
 	cur := pre
 	for _, part := range parts {
 		if cur.NextParts == nil {
@@ -63,7 +79,7 @@ func (pre *PrefixIndex) AddPrefix(prefix string) {
 }
 
 func (pre *PrefixIndex) RemovePrefix(prefix string) {
-	parts := strings.Split(prefix, ".")
+	parts := strings.Split(prefix, pre.separator())
 	cur := pre
 	var path []*PrefixIndex
 	path = append(path, cur)
@@ -100,7 +116,7 @@ func (pre *PrefixIndex) RemovePrefix(prefix string) {
 }
 
 func (pre *PrefixIndex) FindPrefix(key string) string {
-	parts := strings.Split(key, ".")
+	parts := strings.Split(key, pre.separator())
 	cur := pre
 	for _, part := range parts {
 		if cur.Prefix != "" {
@@ -115,6 +131,40 @@ func (pre *PrefixIndex) FindPrefix(key string) string {
 	return cur.Prefix
 }
 
+// Find returns the node of prefix, nil if no prefix added starts with it.
+func (pre *PrefixIndex) Find(prefix string) *PrefixIndex {
+	if prefix == "" {
+		return pre
+	}
+	cur := pre
+	for _, part := range strings.Split(prefix, pre.separator()) {
+		next, ok := cur.NextParts[part]
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+// Walk calls f with the prefixes added under the node in sorted order, it stops if f returns false.
+func (pre *PrefixIndex) Walk(f func(prefix string) bool) bool {
+	if pre.Prefix != "" && !f(pre.Prefix) {
+		return false
+	}
+	parts := make([]string, 0, len(pre.NextParts))
+	for part := range pre.NextParts {
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	for _, part := range parts {
+		if !pre.NextParts[part].Walk(f) {
+			return false
+		}
+	}
+	return true
+}
+
 // Event generated when any config changes.
 type Event struct {
 	EventSource string
@@ -122,6 +172,30 @@ type Event struct {
 	Key         string
 	Value       interface{}
 	HasUpdated  bool
+	// Sensitive is set by the manager if the key is sensitive or its value resolves a sensitive key,
+	// the value is masked in String
+	Sensitive bool
+}
+
+// String returns the event in which the value of a sensitive key is masked,
+// so events can be logged safely.
+func (e Event) String() string {
+	value := e.Value
+	if e.Sensitive && value != nil {
+		value = redact.Mask
+	}
+	return fmt.Sprintf("{EventSource:%s EventType:%s Key:%s Value:%v HasUpdated:%t}",
+		e.EventSource, e.EventType, e.Key, value, e.HasUpdated)
+}
+
+// Keys returns the keys of events, for the logs of the sources
+// which do not know the sensitive keys of the manager and must not log the values.
+func Keys(events []*Event) []string {
+	keys := make([]string, 0, len(events))
+	for _, e := range events {
+		keys = append(keys, e.Key)
+	}
+	return keys
 }
 
 // Listener All Listener should implement this Interface.
@@ -139,6 +213,8 @@ type Dispatcher struct {
 	listeners         map[string][]Listener
 	moduleListeners   map[string][]ModuleListener
 	modulePrefixIndex PrefixIndex
+	// mux guards the listeners, events may be dispatched by the goroutines of the sources
+	mux sync.RWMutex
 }
 
 // NewDispatcher is a new Dispatcher for listeners.
@@ -149,6 +225,13 @@ func NewDispatcher() *Dispatcher {
 	return dis
 }
 
+// SetSeparator set the separator of keys, which splits the prefixes of module listeners.
+func (dis *Dispatcher) SetSeparator(sep string) {
+	dis.mux.Lock()
+	defer dis.mux.Unlock()
+	dis.modulePrefixIndex.Separator = sep
+}
+
 // RegisterListener registers listener for particular configuration.
 func (dis *Dispatcher) RegisterListener(listenerObj Listener, keys ...string) error {
 	if listenerObj == nil {
@@ -157,6 +240,8 @@ func (dis *Dispatcher) RegisterListener(listenerObj Listener, keys ...string) er
 		return ErrNilListener
 	}
 
+	dis.mux.Lock()
+	defer dis.mux.Unlock()
 	for _, key := range keys {
 		listenerList, ok := dis.listeners[key]
 		if !ok {
@@ -185,6 +270,8 @@ func (dis *Dispatcher) UnRegisterListener(listenerObj Listener, keys ...string)
 		return ErrNilListener
 	}
 
+	dis.mux.Lock()
+	defer dis.mux.Unlock()
 	for _, key := range keys {
 		listenerList, ok := dis.listeners[key]
 		if !ok {
@@ -211,6 +298,8 @@ func (dis *Dispatcher) DispatchEvent(event *Event) error {
 	if event == nil {
 		return errors.New("empty event provided")
 	}
+	dis.mux.RLock()
+	defer dis.mux.RUnlock()
 
 	for regKey, listeners := range dis.listeners {
 		matched, err := regexp.MatchString(regKey, event.Key)
@@ -237,6 +326,8 @@ func (dis *Dispatcher) RegisterModuleListener(listenerObj ModuleListener, module
 		return ErrNilListener
 	}
 
+	dis.mux.Lock()
+	defer dis.mux.Unlock()
 	for _, prefix := range modulePrefixes {
 		moduleListeners, ok := dis.moduleListeners[prefix]
 		if !ok {
@@ -266,6 +357,8 @@ func (dis *Dispatcher) UnRegisterModuleListener(listenerObj ModuleListener, modu
 		return ErrNilListener
 	}
 
+	dis.mux.Lock()
+	defer dis.mux.Unlock()
 	for _, prefix := range modulePrefixes {
 		listenerList, ok := dis.moduleListeners[prefix]
 		if !ok {
@@ -295,6 +388,8 @@ func (dis *Dispatcher) DispatchModuleEvent(events []*Event) error {
 	if events == nil || len(events) == 0 {
 		return errors.New("empty events provided")
 	}
+	dis.mux.RLock()
+	defer dis.mux.RUnlock()
 
 	// 1. According to the key in the event, events with the same prefix are placed in the same slice
 	eventsList := dis.parseEvents(events)
@@ -338,7 +433,7 @@ func (dis *Dispatcher) parseEvents(events []*Event) map[string][]*Event {
 // Find first prefix from event.key
 // Ignore the case where namespace and module key(prefix) have the same name.
 func (dis *Dispatcher) findFirstRegisterPrefix(eventKey string) string {
-	keyArr := strings.Split(eventKey, ".")
+	keyArr := strings.Split(eventKey, dis.modulePrefixIndex.separator())
 	for _, key := range keyArr {
 		if _, ok := dis.moduleListeners[key]; ok {
 			return key
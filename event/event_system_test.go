@@ -170,3 +170,26 @@ func TestDispatcher_DispatchModuleEvent(t *testing.T) {
 		}
 	})
 }
+
+func TestPrefixIndex_FindWalk(t *testing.T) {
+	index := event.PrefixIndex{}
+	for _, k := range []string{"redis.addr", "redis.pool.size", "redis", "redisx.addr", "db.host"} {
+		index.AddPrefix(k)
+	}
+	walk := func(node *event.PrefixIndex) []string {
+		var keys []string
+		node.Walk(func(prefix string) bool {
+			keys = append(keys, prefix)
+			return true
+		})
+		return keys
+	}
+
+	assert.Equal(t, []string{"redis", "redis.addr", "redis.pool.size"}, walk(index.Find("redis")))
+	assert.Equal(t, []string{"redis.pool.size"}, walk(index.Find("redis.pool")))
+	assert.Equal(t, []string{"db.host", "redis", "redis.addr", "redis.pool.size", "redisx.addr"}, walk(index.Find("")))
+	assert.Nil(t, index.Find("redis.none"))
+
+	index.RemovePrefix("redis")
+	assert.Equal(t, []string{"redis.addr", "redis.pool.size"}, walk(index.Find("redis")))
+}
@@ -3,6 +3,7 @@ module github.com/arielsrv/go-archaius
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/Shonminh/apollo-client v0.6.0
 	github.com/antonfisher/nested-logrus-formatter v1.3.1
 	github.com/fsnotify/fsnotify v1.6.0
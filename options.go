@@ -2,7 +2,13 @@ package archaius
 
 import (
 	"crypto/tls"
+	"time"
 
+	"github.com/arielsrv/go-archaius/pkg/cipher"
+	"github.com/arielsrv/go-archaius/source"
+	"github.com/arielsrv/go-archaius/source/cli"
+	"github.com/arielsrv/go-archaius/source/env"
+	filesource "github.com/arielsrv/go-archaius/source/file"
 	"github.com/arielsrv/go-archaius/source/util"
 )
 
@@ -39,12 +45,42 @@ type RemoteInfo struct {
 type Options struct {
 	RequiredFiles []string
 	OptionalFiles []string
+	LayeredFiles  []string
+	Profiles      []string
 	FileHandler   util.FileHandler
 	RemoteInfo    *RemoteInfo
 	RemoteSource  string
 	UseCLISource  bool
 	UseENVSource  bool
 	UseMemSource  bool
+
+	UnmarshalOptions []UnmarshalOption
+	// ValueTransformers run in order on every value of all sources
+	ValueTransformers []ValueTransformer
+	Cipher            cipher.Cipher
+	SensitiveKeys     []string
+
+	KeySeparator   string
+	LowerCaseKeys  bool
+	KeyNormalizers map[string]KeyNormalizer
+
+	// FileWatchMode decides how the changes of the files are watched, auto by default
+	FileWatchMode    filesource.WatchMode
+	FilePollInterval time.Duration
+
+	// NamedFileSources are the file sources besides the default one
+	NamedFileSources []NamedFileSource
+}
+
+// NamedFileSource is a file source with its own name and source priority,
+// so that its files are placed on either side of the other sources.
+type NamedFileSource struct {
+	Name string
+	// Priority among the sources, the lower the higher the precedence, compare it with the priorities
+	// of the built-in sources: kie.Priority, mem.Priority, cli.Priority, env.Priority,
+	// filesource.FileSourcePriority and defaults.Priority
+	Priority int
+	Files    []string
 }
 
 // Option is a func.
@@ -64,6 +100,53 @@ func WithOptionalFiles(f []string) Option {
 	}
 }
 
+// WithLayeredFiles tell archaius to manage files in layers, a later file overrides an earlier one,
+// like WithLayeredFiles("defaults.yaml", "app.yaml", "local.yaml"). if not exist will return error.
+// the files of WithRequiredFiles and WithOptionalFiles override all of them.
+func WithLayeredFiles(f ...string) Option {
+	return func(options *Options) {
+		options.LayeredFiles = f
+	}
+}
+
+// WithProfiles activates profiles, each file like app.yaml is overlaid by app-{profile}.yaml if it exists,
+// a later profile overrides an earlier one, and all of them override the file itself.
+// the profiles given by the ARCHAIUS_PROFILES env or the --archaius.profiles command line argument,
+// like --archaius.profiles=prod,eu or --archaius.profiles prod,eu, separated by commas, replace them.
+func WithProfiles(profiles ...string) Option {
+	return func(options *Options) {
+		options.Profiles = profiles
+	}
+}
+
+// WithFileWatchMode decides how the changes of the files are watched,
+// filesource.WatchAuto uses fsnotify and polls the files it can not watch.
+func WithFileWatchMode(mode filesource.WatchMode) Option {
+	return func(options *Options) {
+		options.FileWatchMode = mode
+	}
+}
+
+// WithFilePolling polls the files at interval instead of using fsnotify,
+// for NFS and the file systems fsnotify does not work on.
+func WithFilePolling(interval time.Duration) Option {
+	return func(options *Options) {
+		options.FileWatchMode = filesource.WatchPoll
+		options.FilePollInterval = interval
+	}
+}
+
+// WithNamedFileSource adds a file source named name with the source priority and the required files,
+// like WithNamedFileSource("defaults", defaults.Priority-1, "defaults.yaml") below env and
+// WithNamedFileSource("overrides", 0, "overrides.yaml") above cli.
+// the name must differ from the other sources, AddFile adds files to it by WithFileSourceName.
+func WithNamedFileSource(name string, priority int, files ...string) Option {
+	return func(options *Options) {
+		options.NamedFileSources = append(options.NamedFileSources,
+			NamedFileSource{Name: name, Priority: priority, Files: files})
+	}
+}
+
 // WithDefaultFileHandler let user custom handler
 // you can decide how to convert file into kv pairs.
 
@@ -93,9 +176,90 @@ func WithMemorySource() Option {
 	}
 }
 
+// WithUnmarshalOptions set the default options of UnmarshalConfig,
+// the options given to UnmarshalConfig are applied after them.
+func WithUnmarshalOptions(opts ...UnmarshalOption) Option {
+	return func(options *Options) {
+		options.UnmarshalOptions = append(options.UnmarshalOptions, opts...)
+	}
+}
+
+// WithValueTransformers appends transformers to the pipeline
+// which runs on the values of all sources before they are read or dispatched in events.
+func WithValueTransformers(transformers ...ValueTransformer) Option {
+	return func(options *Options) {
+		options.ValueTransformers = append(options.ValueTransformers, transformers...)
+	}
+}
+
+// WithCipher set the cipher which decrypts the values written as ENC(cipher text),
+// only Get, GetValue and UnmarshalConfig return the plain text,
+// GetConfigs, WriteTo and events keep the cipher text.
+func WithCipher(c cipher.Cipher) Option {
+	return func(options *Options) {
+		options.Cipher = c
+	}
+}
+
+// WithSensitiveKeys marks the keys matching the glob patterns as sensitive, like *password* or db.*.secret,
+// their values are masked in WriteTo, GetConfigsWithSourceNames, logs and the string form of events,
+// Get still returns the real value.
+func WithSensitiveKeys(patterns ...string) Option {
+	return func(options *Options) {
+		options.SensitiveKeys = append(options.SensitiveKeys, patterns...)
+	}
+}
+
+// AliasOption is a func.
+type AliasOption = source.AliasOption
+
+// Deprecated marks the old key of an alias deprecated, msg is logged if a source still provides it,
+// for example Deprecated("use db.host instead").
+func Deprecated(msg string) AliasOption {
+	return source.Deprecated(msg)
+}
+
+// KeyNormalizer converts a key of a source into the key archaius uses.
+type KeyNormalizer = source.KeyNormalizer
+
+// WithKeySeparator set the separator of keys, like / in db/host, it is . by default.
+// the keys of files, cli and env are written with ., so . in them is replaced by the separator,
+// unless a KeyNormalizer is set for the source.
+func WithKeySeparator(sep string) Option {
+	return func(options *Options) {
+		options.KeySeparator = sep
+	}
+}
+
+// WithLowerCaseKeys lower cases the keys of all sources and the keys given to the APIs,
+// so APP_DB_HOST of env, --app.db.host of cli and app.db.host of a file are the same key app.db.host.
+// the keys given to RegisterListener are regular expressions, they are not changed.
+func WithLowerCaseKeys() Option {
+	return func(options *Options) {
+		options.LowerCaseKeys = true
+	}
+}
+
+// WithSourceKeyNormalizer set the KeyNormalizer of the source named sourceName, like env.Name,
+// it runs before the keys are lower cased.
+func WithSourceKeyNormalizer(sourceName string, n KeyNormalizer) Option {
+	return func(options *Options) {
+		if options.KeyNormalizers == nil {
+			options.KeyNormalizers = make(map[string]KeyNormalizer)
+		}
+		options.KeyNormalizers[sourceName] = n
+	}
+}
+
 // FileOptions for AddFile func.
 type FileOptions struct {
 	Handler util.FileHandler
+	// Priority of the file, the lower the higher the precedence, filesource.DefaultFilePriority by default
+	Priority uint32
+	// SourceName is the name of the file source of WithNamedFileSource to add the file to
+	SourceName string
+	// DirOptions decide which files of a directory are managed
+	DirOptions []filesource.DirOption
 }
 
 // FileOption is a func.
@@ -107,3 +271,131 @@ func WithFileHandler(h util.FileHandler) FileOption {
 		options.Handler = h
 	}
 }
+
+// WithFilePriority sets the priority of the file among the other files, the lower the higher the precedence,
+// the files added without it have filesource.DefaultFilePriority, the highest precedence.
+func WithFilePriority(priority uint32) FileOption {
+	return func(options *FileOptions) {
+		options.Priority = priority
+	}
+}
+
+// WithFileSourceName adds the file to the file source of WithNamedFileSource named name.
+func WithFileSourceName(name string) FileOption {
+	return func(options *FileOptions) {
+		options.SourceName = name
+	}
+}
+
+// WithRecursive manages the files in the sub directories of a directory too.
+func WithRecursive() FileOption {
+	return func(options *FileOptions) {
+		options.DirOptions = append(options.DirOptions, filesource.Recursive())
+	}
+}
+
+// WithIncludeFiles manages only the files of a directory matching one of the glob patterns,
+// ** matches any number of directories, a pattern with a / matches the path relative to the directory,
+// otherwise the file name.
+func WithIncludeFiles(patterns ...string) FileOption {
+	return func(options *FileOptions) {
+		options.DirOptions = append(options.DirOptions, filesource.Include(patterns...))
+	}
+}
+
+// WithExcludeFiles ignores the files of a directory matching one of the glob patterns.
+func WithExcludeFiles(patterns ...string) FileOption {
+	return func(options *FileOptions) {
+		options.DirOptions = append(options.DirOptions, filesource.Exclude(patterns...))
+	}
+}
+
+// UnmarshalOption is a func.
+type UnmarshalOption = source.UnmarshalOption
+
+// Strict let UnmarshalConfig return error
+// if some config keys under the struct sections are not consumed by any field,
+// or some struct fields got no value. the top-level keys the struct does not model are not checked,
+// and the keys of the env and command line sources are not reported,
+// they hold all the env variables and arguments of the process.
+func Strict() UnmarshalOption {
+	return source.WithStrict(env.Name, cli.Name)
+}
+
+// TagName let UnmarshalConfig get the key of a field from the given struct tags,
+// the tags are tried in order, for example TagName("mapstructure", "json", "yaml").
+func TagName(tagNames ...string) UnmarshalOption {
+	return source.WithTagName(tagNames...)
+}
+
+// CaseInsensitive let UnmarshalConfig match keys ignoring case,
+// a field without tag name is matched by its snake case, or by its name if no key matches the snake case.
+func CaseInsensitive() UnmarshalOption {
+	return source.WithCaseInsensitive()
+}
+
+// ValueTransformer converts the value of key which comes from the source named sourceName.
+type ValueTransformer = source.ValueTransformer
+
+// ExpandEnv returns a transformer which expands env variables like ${NAME||default} in string values.
+func ExpandEnv() ValueTransformer {
+	return source.ExpandEnv
+}
+
+// TrimSpace returns a transformer which removes the leading and trailing white space of string values.
+func TrimSpace() ValueTransformer {
+	return source.TrimSpace
+}
+
+// SetOptions hold options of Set.
+type SetOptions struct {
+	Sensitive bool
+}
+
+// SetOption is a func.
+type SetOption func(options *SetOptions)
+
+// Sensitive marks the key as sensitive, its value is masked in dumps, logs and events.
+func Sensitive() SetOption {
+	return func(options *SetOptions) {
+		options.Sensitive = true
+	}
+}
+
+// WriteOption is a func.
+type WriteOption = source.MarshalOption
+
+// OutputFormat is the format of WriteTo.
+type OutputFormat = source.Format
+
+// output formats.
+const (
+	YAML       = source.FormatYAML
+	JSON       = source.FormatJSON
+	TOML       = source.FormatTOML
+	Properties = source.FormatProperties
+	Dotenv     = source.FormatDotenv
+)
+
+// ConfigView decides which config WriteTo writes.
+type ConfigView = source.View
+
+// views of WriteTo.
+const (
+	// PerSource writes the key values of each source under the source name.
+	PerSource = source.ViewPerSource
+	// Merged writes the key values the application gets, the dotted keys are nested.
+	Merged = source.ViewMerged
+	// WithProvenance writes the key values the application gets along with their source name.
+	WithProvenance = source.ViewWithProvenance
+)
+
+// Format set the format of WriteTo, default is YAML.
+func Format(f OutputFormat) WriteOption {
+	return source.WithFormat(f)
+}
+
+// View set the view of WriteTo, default is PerSource.
+func View(v ConfigView) WriteOption {
+	return source.WithView(v)
+}
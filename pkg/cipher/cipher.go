@@ -0,0 +1,151 @@
+// Package cipher decrypts the config values written as ENC(base64 cipher text).
+package cipher
+
+import (
+	"crypto/aes"
+	stdcipher "crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	encPrefix = "ENC("
+	encSuffix = ")"
+
+	base64KeyPrefix = "base64:"
+)
+
+// errors.
+var (
+	ErrInvalidKey        = errors.New("aes key must be 16, 24 or 32 bytes")
+	ErrInvalidCipherText = errors.New("invalid cipher text")
+)
+
+// Cipher encrypts and decrypts config values.
+type Cipher interface {
+	Encrypt(plainText string) (string, error)
+	Decrypt(cipherText string) (string, error)
+}
+
+// IsEncrypted checks if value is written as ENC(cipher text).
+func IsEncrypted(value string) bool {
+	value = strings.TrimSpace(value)
+	return len(value) > len(encPrefix)+len(encSuffix) &&
+		strings.HasPrefix(value, encPrefix) && strings.HasSuffix(value, encSuffix)
+}
+
+// Unwrap returns the cipher text in ENC(cipher text), and false if value is not encrypted.
+func Unwrap(value string) (string, bool) {
+	if !IsEncrypted(value) {
+		return value, false
+	}
+	value = strings.TrimSpace(value)
+	return value[len(encPrefix) : len(value)-len(encSuffix)], true
+}
+
+// EncryptValue encrypts plainText by c and writes it as ENC(cipher text),
+// the result can be put into config files or config centers.
+func EncryptValue(c Cipher, plainText string) (string, error) {
+	cipherText, err := c.Encrypt(plainText)
+	if err != nil {
+		return "", err
+	}
+	return encPrefix + cipherText + encSuffix, nil
+}
+
+// AESGCM is a Cipher using AES in GCM mode,
+// the cipher text is the base64 encoding of the nonce followed by the sealed data.
+type AESGCM struct {
+	aead stdcipher.AEAD
+}
+
+// NewAESGCM creates an AES-GCM cipher by a key of 16, 24 or 32 bytes.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := stdcipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// NewAESGCMFromFile creates an AES-GCM cipher by the key in a file,
+// the key is written as raw bytes or as base64:<base64 key>.
+func NewAESGCMFromFile(path string) (*AESGCM, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read aes key file %s failed: %w", path, err)
+	}
+	key, err := parseKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESGCM(key)
+}
+
+// NewAESGCMFromEnv creates an AES-GCM cipher by the key in an env variable,
+// the key is written as raw bytes or as base64:<base64 key>.
+func NewAESGCMFromEnv(name string) (*AESGCM, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("aes key env %s is not set", name)
+	}
+	key, err := parseKey([]byte(v))
+	if err != nil {
+		return nil, err
+	}
+	return NewAESGCM(key)
+}
+
+// parseKey decodes a key written as base64:<base64 key>, other keys are raw bytes.
+func parseKey(b []byte) ([]byte, error) {
+	s := strings.TrimSpace(string(b))
+	if !strings.HasPrefix(s, base64KeyPrefix) {
+		return []byte(s), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, base64KeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+	return key, nil
+}
+
+// Encrypt seals plainText with a random nonce.
+func (c *AESGCM) Encrypt(plainText string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plainText), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens the cipher text made by Encrypt.
+func (c *AESGCM) Decrypt(cipherText string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cipherText))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidCipherText, err)
+	}
+	if len(b) < c.aead.NonceSize() {
+		return "", ErrInvalidCipherText
+	}
+	nonce, sealed := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidCipherText, err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,60 @@
+package cipher_test
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arielsrv/go-archaius/pkg/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAESGCM(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	c, err := cipher.NewAESGCM(key)
+	assert.NoError(t, err)
+
+	t.Run("encrypt and decrypt", func(t *testing.T) {
+		v, err := cipher.EncryptValue(c, "secret")
+		assert.NoError(t, err)
+		assert.True(t, cipher.IsEncrypted(v))
+		cipherText, ok := cipher.Unwrap(v)
+		assert.True(t, ok)
+		plain, err := c.Decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", plain)
+	})
+	t.Run("invalid cipher text", func(t *testing.T) {
+		_, err := c.Decrypt("bm90IGVuY3J5cHRlZA==")
+		assert.ErrorIs(t, err, cipher.ErrInvalidCipherText)
+		_, ok := cipher.Unwrap("plain")
+		assert.False(t, ok)
+	})
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := cipher.NewAESGCM([]byte("short"))
+		assert.Equal(t, cipher.ErrInvalidKey, err)
+	})
+	t.Run("key from file and env", func(t *testing.T) {
+		d := t.TempDir()
+		keyFile := filepath.Join(d, "aes.key")
+		err := os.WriteFile(keyFile, []byte("base64:"+base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+		assert.NoError(t, err)
+		fc, err := cipher.NewAESGCMFromFile(keyFile)
+		assert.NoError(t, err)
+
+		os.Setenv("CIPHER_TEST_KEY", string(key))
+		defer os.Unsetenv("CIPHER_TEST_KEY")
+		ec, err := cipher.NewAESGCMFromEnv("CIPHER_TEST_KEY")
+		assert.NoError(t, err)
+
+		cipherText, err := fc.Encrypt("secret")
+		assert.NoError(t, err)
+		plain, err := ec.Decrypt(cipherText)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", plain)
+
+		_, err = cipher.NewAESGCMFromEnv("CIPHER_TEST_KEY_NOT_EXIST")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,95 @@
+// Package redact masks the values of sensitive keys in config dumps, logs and events.
+package redact
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces the values of sensitive keys.
+const Mask = "******"
+
+// Registry holds the sensitive keys and key patterns of one config manager.
+type Registry struct {
+	mux       sync.RWMutex
+	patterns  []string
+	sensitive map[string]bool
+}
+
+// NewRegistry creates a Registry without sensitive keys.
+func NewRegistry() *Registry {
+	return &Registry{sensitive: make(map[string]bool)}
+}
+
+// AddPatterns marks the keys matching the glob patterns as sensitive,
+// a pattern is matched by path.Match ignoring case, for example *password* or db.*.secret.
+func (r *Registry) AddPatterns(ps ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, p := range ps {
+		r.patterns = append(r.patterns, strings.ToLower(p))
+	}
+}
+
+// MarkSensitive marks the keys as sensitive.
+func (r *Registry) MarkSensitive(keys ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, k := range keys {
+		r.sensitive[k] = true
+	}
+}
+
+// Reset removes all patterns and sensitive keys.
+func (r *Registry) Reset() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.patterns = nil
+	r.sensitive = make(map[string]bool)
+}
+
+// IsSensitive checks if the value of key must be masked.
+func (r *Registry) IsSensitive(key string) bool {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	if r.sensitive[key] {
+		return true
+	}
+	lower := strings.ToLower(key)
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns Mask if key is sensitive, otherwise value.
+func (r *Registry) Value(key string, value interface{}) interface{} {
+	if value == nil || !r.IsSensitive(key) {
+		return value
+	}
+	return Mask
+}
+
+// Map returns a copy of configs in which the values of sensitive keys are masked.
+func (r *Registry) Map(configs map[string]interface{}) map[string]interface{} {
+	masked := make(map[string]interface{}, len(configs))
+	for k, v := range configs {
+		masked[k] = r.Value(k, v)
+	}
+	return masked
+}
+
+// Keys returns the sorted keys of configs, for the logs of the sources
+// which do not know the sensitive keys of the manager and must not log the values.
+func Keys(configs map[string]interface{}) []string {
+	keys := make([]string, 0, len(configs))
+	for k := range configs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
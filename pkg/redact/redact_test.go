@@ -0,0 +1,33 @@
+package redact_test
+
+import (
+	"testing"
+
+	"github.com/arielsrv/go-archaius/pkg/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	r := redact.NewRegistry()
+	r.AddPatterns("*password*", "db.*.secret")
+	r.MarkSensitive("api.key")
+
+	assert.True(t, r.IsSensitive("db.password"))
+	assert.True(t, r.IsSensitive("DB.PASSWORD"))
+	assert.True(t, r.IsSensitive("db.main.secret"))
+	assert.True(t, r.IsSensitive("api.key"))
+	assert.False(t, r.IsSensitive("db.host"))
+	assert.False(t, r.IsSensitive("api.key.name"))
+
+	masked := r.Map(map[string]interface{}{"db.password": "s3cret", "db.host": "10.0.0.1"})
+	assert.Equal(t, map[string]interface{}{"db.password": redact.Mask, "db.host": "10.0.0.1"}, masked)
+
+	t.Run("registries are independent", func(t *testing.T) {
+		other := redact.NewRegistry()
+		assert.False(t, other.IsSensitive("db.password"))
+		assert.False(t, other.IsSensitive("api.key"))
+	})
+
+	r.Reset()
+	assert.False(t, r.IsSensitive("db.password"))
+}
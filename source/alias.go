@@ -0,0 +1,154 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrAliasInvalid is returned if an alias can not be registered.
+var ErrAliasInvalid = errors.New("invalid alias")
+
+// AliasOptions hold options of an alias.
+type AliasOptions struct {
+	// Deprecated logs a warning once if a source still provides the old key
+	Deprecated bool
+	// Message tells what to use instead of the old key
+	Message string
+}
+
+// AliasOption is a func.
+type AliasOption func(options *AliasOptions)
+
+// Deprecated marks the old key deprecated, msg is logged if a source still provides it.
+func Deprecated(msg string) AliasOption {
+	return func(options *AliasOptions) {
+		options.Deprecated = true
+		options.Message = msg
+	}
+}
+
+type alias struct {
+	newKey string
+	opts   AliasOptions
+}
+
+// RegisterAlias makes oldKey another name of newKey, reading either key returns the same value,
+// which comes from the key provided by the source with the highest priority, newKey wins a tie.
+// the events of one key are also dispatched with the other name.
+func (m *Manager) RegisterAlias(oldKey, newKey string, opts ...AliasOption) error {
+	oldKey, newKey = m.canonicalKey(oldKey), m.canonicalKey(newKey)
+	if oldKey == "" || newKey == "" || oldKey == newKey {
+		return fmt.Errorf("%w: %s -> %s", ErrAliasInvalid, oldKey, newKey)
+	}
+	o := AliasOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m.aliasMux.Lock()
+	if m.aliases == nil {
+		m.aliases = make(map[string]alias)
+		m.aliasesOf = make(map[string][]string)
+	}
+	if a, ok := m.aliases[oldKey]; ok && a.newKey != newKey {
+		m.aliasMux.Unlock()
+		return fmt.Errorf("%w: %s is an alias of %s already", ErrAliasInvalid, oldKey, a.newKey)
+	}
+	if _, ok := m.aliases[newKey]; ok || len(m.aliasesOf[oldKey]) != 0 {
+		m.aliasMux.Unlock()
+		return fmt.Errorf("%w: %s -> %s makes an alias of an alias", ErrAliasInvalid, oldKey, newKey)
+	}
+	if _, ok := m.aliases[oldKey]; !ok {
+		m.aliasesOf[newKey] = append(m.aliasesOf[newKey], oldKey)
+	}
+	m.aliases[oldKey] = alias{newKey: newKey, opts: o}
+	m.aliasMux.Unlock()
+
+	if sourceName, ok := m.ConfigurationMap.Load(oldKey); ok {
+		m.warnDeprecated(oldKey, sourceName)
+	}
+	return nil
+}
+
+// aliasNames returns all the names of key, the new key first, nil if key has no alias.
+func (m *Manager) aliasNames(key string) []string {
+	m.aliasMux.RLock()
+	defer m.aliasMux.RUnlock()
+	if a, ok := m.aliases[key]; ok {
+		key = a.newKey
+	}
+	oldKeys := m.aliasesOf[key]
+	if len(oldKeys) == 0 {
+		return nil
+	}
+	return append([]string{key}, oldKeys...)
+}
+
+// aliasedKey returns the name of key which is provided by the source with the highest priority,
+// and false if no name of key is provided.
+func (m *Manager) aliasedKey(key string) (string, bool) {
+	names := m.aliasNames(key)
+	if names == nil {
+		_, ok := m.ConfigurationMap.Load(key)
+		return key, ok
+	}
+	found, priority := "", 0
+	for _, name := range names {
+		sourceName, ok := m.ConfigurationMap.Load(name)
+		if !ok {
+			continue
+		}
+		m.sourceMapMux.RLock()
+		s, ok := m.Sources[sourceName.(string)]
+		m.sourceMapMux.RUnlock()
+		if !ok {
+			continue
+		}
+		if found == "" || s.GetPriority() < priority {
+			found, priority = name, s.GetPriority()
+		}
+	}
+	if found == "" {
+		return key, false
+	}
+	return found, true
+}
+
+// aliasEvents returns the events of es with the other names of their keys,
+// for the names whose value comes from the key of the event.
+func (m *Manager) aliasEvents(es ...*event.Event) []*event.Event {
+	var aliasEvents []*event.Event
+	for _, e := range es {
+		for _, name := range m.aliasNames(e.Key) {
+			if name == e.Key {
+				continue
+			}
+			current, ok := m.aliasedKey(name)
+			if (ok && current != e.Key) || (!ok && e.EventType != event.Delete) {
+				continue
+			}
+			ae := *e
+			ae.Key = name
+			aliasEvents = append(aliasEvents, &ae)
+		}
+	}
+	return aliasEvents
+}
+
+// warnDeprecated logs a warning once if key is a deprecated alias provided by a source.
+func (m *Manager) warnDeprecated(key string, sourceName interface{}) {
+	m.aliasMux.RLock()
+	a, ok := m.aliases[key]
+	m.aliasMux.RUnlock()
+	if !ok || !a.opts.Deprecated {
+		return
+	}
+	if _, warned := m.deprecationWarned.LoadOrStore(fmt.Sprintf("%s/%s", sourceName, key), true); warned {
+		return
+	}
+	logrus.Warn(fmt.Sprintf("key %s of %s is deprecated, it is an alias of %s: %s",
+		key, sourceName, a.newKey, a.opts.Message))
+}
@@ -27,8 +27,9 @@ import (
 
 // const.
 const (
-	Name                = "CommandlineSource"
-	commandlinePriority = 2
+	Name = "CommandlineSource"
+	// Priority is the source priority of the command line source.
+	Priority = 2
 )
 
 // Source is source for all configuration.
@@ -42,7 +43,7 @@ type Source struct {
 // NewCommandlineConfigSource defines a function used for creating configuration source.
 func NewCommandlineConfigSource() source.ConfigSource {
 	cmdlineConfig := new(Source)
-	cmdlineConfig.priority = commandlinePriority
+	cmdlineConfig.priority = Priority
 	config := cmdlineConfig.pullCmdLineConfig()
 	cmdlineConfig.Configurations = config
 
@@ -69,6 +69,9 @@ type configMapSource struct {
 	fileLock       sync.Mutex
 	priority       int
 	sync.RWMutex
+
+	// links holds the file each file resolves to through symlinks
+	links *util.Links
 }
 
 type file struct {
@@ -98,6 +101,7 @@ func NewConfigMapSource() ConfigMapSource {
 		configMapConfigSource.priority = configMapSourcePriority
 		configMapConfigSource.files = make([]file, 0)
 		configMapConfigSource.fileHandlers = make(map[string]util.FileHandler)
+		configMapConfigSource.links = util.NewLinks()
 	}
 
 	return configMapConfigSource
@@ -114,11 +118,19 @@ func (cmSource *configMapSource) AddFile(p string, priority uint32, handle util.
 	}
 	cmSource.fileHandlers[path] = handle
 
+	root := p
 	err = filepath.Walk(p,
 		func(p string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
+			// the ..data and ..timestamp entries of kubernetes hold the files the other entries link to
+			if p != root && isDataEntry(p) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			path, err = filepath.Abs(p)
 			if err != nil {
 				return err
@@ -138,9 +150,7 @@ func (cmSource *configMapSource) AddFile(p string, priority uint32, handle util.
 				}
 			case RegularFile:
 				err := cmSource.handleFile(fs, priority, handle)
-				if cmSource.watchPool != nil {
-					cmSource.watchPool.AddWatchFile(path)
-				}
+				cmSource.watchPath(path)
 				if err != nil {
 					logrus.Error(fmt.Sprintf("Failed to handle file [%s] [%s]", path, err))
 					return err
@@ -314,9 +324,11 @@ func (cmSource *configMapSource) Watch(callback source.EventHandler) error {
 		return err
 	}
 
+	cmSource.Lock()
 	cmSource.watchPool = watchPool
+	cmSource.Unlock()
 
-	go cmSource.watchPool.startWatchPool()
+	go watchPool.startWatchPool(cmSource.filePaths())
 
 	return nil
 }
@@ -336,19 +348,17 @@ func newWatchPool(callback source.EventHandler, cfgSrc *configMapSource) (*watch
 	return watch, nil
 }
 
-func (wth *watch) startWatchPool() {
+func (wth *watch) startWatchPool(filePaths []string) {
+	wth.RLock()
+	cmSource := wth.configMapSource
+	wth.RUnlock()
 	go wth.watchFile()
-	for _, file := range wth.configMapSource.files {
-		f, err := filepath.Abs(file.filePath)
-		if err != nil {
-			logrus.Error(fmt.Sprintf("failed to get Directory info from: %s file: %s", file.filePath, err))
-			return
-		}
-
-		err = wth.watcher.Add(f)
-		if err != nil {
-			logrus.Error(fmt.Sprintf("add watcher file: %+v fail %s", file, err))
-			return
+	if cmSource == nil {
+		return
+	}
+	for _, filePath := range filePaths {
+		for _, d := range cmSource.links.Track(filePath) {
+			wth.AddWatchFile(d)
 		}
 	}
 }
@@ -375,19 +385,27 @@ func (wth *watch) watchFile() {
 				continue
 			}
 
+			// a symlink swap like the ..data of kubernetes, or a write to the target of a symlink,
+			// reloads the files resolving to the changed file
+			for _, f := range wth.configMapSource.links.Changed(event.Name) {
+				wth.configMapSource.reload(wth, f)
+			}
+			if isDataEntry(event.Name) {
+				continue
+			}
+
 			if event.Op == fsnotify.Remove {
 				logrus.Warn(fmt.Sprintf("the file change mode: %s, continue", event.String()))
 				continue
 			}
 
 			if event.Op == fsnotify.Rename {
-				wth.watcher.Remove(event.Name)
-				// check existence of file
-				_, err := os.Open(event.Name)
+				// check existence of file, a file replaced by another one is reloaded
+				_, err := os.Stat(event.Name)
 				if os.IsNotExist(err) {
 					logrus.Warn(fmt.Sprintf("[%s] file does not exist so not able to watch further: %s", event.Name, err))
-				} else {
-					wth.AddWatchFile(event.Name)
+				} else if wth.configMapSource.isFileSrcExist(event.Name) {
+					wth.configMapSource.reload(wth, event.Name)
 				}
 
 				continue
@@ -408,25 +426,10 @@ func (wth *watch) watchFile() {
 
 func (cmSource *configMapSource) updateFile(wth *watch, event fsnotify.Event) {
 	if wth.configMapSource.isFileSrcExist(event.Name) {
-		handle := wth.configMapSource.fileHandlers[event.Name]
-		if handle == nil {
-			handle = util.Convert2JavaProps
-		}
-		content, err := os.ReadFile(event.Name)
-		if err != nil {
-			logrus.Error("read file error " + err.Error())
-			return
-		}
-
-		newConf, err := handle(event.Name, content)
-		if err != nil {
-			logrus.Error("convert error " + err.Error())
-			return
-		}
-		events := wth.configMapSource.compareUpdate(newConf, event.Name)
-		for _, e := range events {
-			wth.callback.OnEvent(e)
-		}
+		cmSource.reload(wth, event.Name)
+	} else if strings.HasPrefix(filepath.Base(event.Name), ".") {
+		// hidden files, like the temp files of atomic writes, are not added
+		return
 	} else {
 		var priority uint32 = configMapSourcePriority
 		for _, file := range wth.configMapSource.files {
@@ -435,13 +438,79 @@ func (cmSource *configMapSource) updateFile(wth *watch, event fsnotify.Event) {
 			}
 		}
 
-		var fileHandler util.FileHandler
-		for path, handler := range wth.configMapSource.fileHandlers {
-			if strings.Contains(event.Name, path) {
-				fileHandler = handler
-			}
+		wth.configMapSource.AddFile(event.Name, priority, wth.configMapSource.fileHandler(event.Name))
+	}
+}
+
+// reload reads a managed file again with the FileHandler given to AddFile for it or its directory.
+func (cmSource *configMapSource) reload(wth *watch, filePath string) {
+	handle := cmSource.fileHandler(filePath)
+	if handle == nil {
+		handle = util.Convert2JavaProps
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		logrus.Error("read file error " + err.Error())
+		return
+	}
+
+	newConf, err := handle(filePath, content)
+	if err != nil {
+		logrus.Error("convert error " + err.Error())
+		return
+	}
+	cmSource.watchPath(filePath)
+	events := cmSource.compareUpdate(newConf, filePath)
+	wth.RLock()
+	callback := wth.callback
+	wth.RUnlock()
+	if callback == nil {
+		return
+	}
+	for _, e := range events {
+		callback.OnEvent(e)
+	}
+}
+
+// fileHandler returns the FileHandler given to AddFile for filePath, or for the closest directory holding it.
+func (cmSource *configMapSource) fileHandler(filePath string) util.FileHandler {
+	var handler util.FileHandler
+	longest := -1
+	for path, h := range cmSource.fileHandlers {
+		if (path == filePath || strings.HasPrefix(filePath, path+string(filepath.Separator))) && len(path) > longest {
+			handler, longest = h, len(path)
 		}
-		wth.configMapSource.AddFile(event.Name, priority, fileHandler)
+	}
+	return handler
+}
+
+// isDataEntry tells whether p is a ..data or ..timestamp entry of a kubernetes ConfigMap volume.
+func isDataEntry(p string) bool {
+	return strings.HasPrefix(filepath.Base(p), "..")
+}
+
+// filePaths returns the paths of the managed files.
+func (cmSource *configMapSource) filePaths() []string {
+	cmSource.RLock()
+	defer cmSource.RUnlock()
+	paths := make([]string, 0, len(cmSource.files))
+	for _, f := range cmSource.files {
+		paths = append(paths, f.filePath)
+	}
+	return paths
+}
+
+// watchPath tracks filePath and watches its directories if the source is watched.
+func (cmSource *configMapSource) watchPath(filePath string) {
+	dirs := cmSource.links.Track(filePath)
+	cmSource.RLock()
+	wth := cmSource.watchPool
+	cmSource.RUnlock()
+	if wth == nil {
+		return
+	}
+	for _, d := range dirs {
+		wth.AddWatchFile(d)
 	}
 }
 
@@ -556,17 +625,21 @@ func (cmSource *configMapSource) Cleanup() error {
 		return nil
 	}
 
-	if cmSource.watchPool != nil && cmSource.watchPool.watcher != nil {
-		cmSource.watchPool.watcher.Close()
-	}
-
-	if cmSource.watchPool != nil {
-		cmSource.watchPool.configMapSource = nil
-		cmSource.watchPool.callback = nil
+	cmSource.Lock()
+	defer cmSource.Unlock()
+	if wth := cmSource.watchPool; wth != nil {
+		if wth.watcher != nil {
+			wth.watcher.Close()
+		}
+		wth.Lock()
+		wth.configMapSource = nil
+		wth.callback = nil
+		wth.Unlock()
 		cmSource.watchPool = nil
 	}
 	cmSource.Configurations = nil
 	cmSource.files = make([]file, 0)
+	cmSource.links.Reset()
 	return nil
 }
 
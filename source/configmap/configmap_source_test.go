@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/source/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -333,3 +334,66 @@ func TestConfigMapSource2(t *testing.T) {
 		t.Error("configmapsource cleanup is Failed")
 	}
 }
+
+// writeConfigMap writes the files like kubernetes does in a ConfigMap volume:
+// the files are links to ..data/name, and ..data is a link to a directory holding the files,
+// it is swapped atomically by a rename on update.
+func writeConfigMap(t *testing.T, dir, version string, files map[string]string) {
+	data := filepath.Join(dir, "..2024_"+version)
+	assert.NoError(t, os.MkdirAll(data, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(data, name), []byte(content), 0600))
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+	old, _ := os.Readlink(filepath.Join(dir, "..data"))
+	assert.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	if old != "" {
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, old)))
+	}
+}
+
+func TestAtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "1", map[string]string{"app.conf": "v1"})
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "local"), 0755))
+	local := filepath.Join(dir, "local", "local.conf")
+	assert.NoError(t, os.WriteFile(local, []byte("v1"), 0600))
+
+	cmSource := NewConfigMapSource()
+	assert.NoError(t, cmSource.Watch(new(TestDynamicConfigHandler)))
+	defer cmSource.Cleanup()
+	assert.NoError(t, cmSource.AddFile(dir, 0, util.UseFileNameAsKeyContentAsValue))
+	configs, err := cmSource.GetConfigurations()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"app.conf": []byte("v1"), "local.conf": []byte("v1")}, configs)
+	// let the file watcher start
+	time.Sleep(100 * time.Millisecond)
+
+	get := func(key string) string {
+		v, _ := cmSource.GetConfigurationByKey(key)
+		b, _ := v.([]byte)
+		return string(b)
+	}
+	t.Run("kubernetes ..data swap", func(t *testing.T) {
+		for _, version := range []string{"2", "3"} {
+			writeConfigMap(t, dir, version, map[string]string{"app.conf": "v" + version})
+			assert.Eventually(t, func() bool {
+				return get("app.conf") == "v"+version
+			}, 3*time.Second, 20*time.Millisecond)
+		}
+	})
+	t.Run("write a temp file and rename it", func(t *testing.T) {
+		for _, content := range []string{"v2", "v3"} {
+			tmp := filepath.Join(dir, "local", ".local.conf.tmp")
+			assert.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+			assert.NoError(t, os.Rename(tmp, local))
+			assert.Eventually(t, func() bool {
+				return get("local.conf") == content
+			}, 3*time.Second, 20*time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package source
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// DecodeFunc converts a config value into a value of the type it is registered for.
+type DecodeFunc func(value interface{}) (interface{}, error)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+	decoderMux sync.RWMutex
+	decoders   = map[reflect.Type]DecodeFunc{
+		reflect.TypeOf(time.Duration(0)): decodeDuration,
+		reflect.TypeOf(time.Time{}):      decodeTime,
+		reflect.TypeOf(url.URL{}):        decodeURL,
+		reflect.TypeOf(net.IPNet{}):      decodeIPNet,
+		reflect.TypeOf(regexp.Regexp{}):  decodeRegexp,
+	}
+)
+
+// RegisterDecoder registers a DecodeFunc for type t,
+// Unmarshal uses it to convert config values into t.
+// the registered DecodeFunc replaces the built-in one of the same type.
+func RegisterDecoder(t reflect.Type, f DecodeFunc) {
+	decoderMux.Lock()
+	defer decoderMux.Unlock()
+	decoders[t] = f
+}
+
+func getDecoder(t reflect.Type) (DecodeFunc, bool) {
+	decoderMux.RLock()
+	defer decoderMux.RUnlock()
+	f, ok := decoders[t]
+	return f, ok
+}
+
+// isDecodable checks if values of type t, or the type t points to,
+// are converted by a DecodeFunc, encoding.TextUnmarshaler or json.Unmarshaler.
+func isDecodable(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		if _, ok := getDecoder(t); ok {
+			return true
+		}
+		t = t.Elem()
+	}
+	if _, ok := getDecoder(t); ok {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	return pt.Implements(textUnmarshalerType) || pt.Implements(jsonUnmarshalerType)
+}
+
+// decode converts confValue into type t by a registered DecodeFunc, encoding.TextUnmarshaler
+// or json.Unmarshaler, the bool result tells if one of them handled the conversion.
+func decode(confValue interface{}, t reflect.Type) (reflect.Value, bool, error) {
+	if confValue == nil {
+		return reflect.Value{}, false, nil
+	}
+	if f, ok := getDecoder(t); ok {
+		v, err := f(confValue)
+		if err != nil {
+			return reflect.Value{}, true, err
+		}
+		rv, err := assignableValue(v, t)
+		return rv, true, err
+	}
+	if reflect.TypeOf(confValue) == t {
+		return reflect.ValueOf(confValue), true, nil
+	}
+
+	pt := reflect.PtrTo(t)
+	switch {
+	case pt.Implements(textUnmarshalerType):
+		ptr := reflect.New(t)
+		var text []byte
+		if b, ok := confValue.([]byte); ok {
+			text = b
+		} else {
+			s, err := cast.ToStringE(confValue)
+			if err != nil {
+				return reflect.Value{}, true, err
+			}
+			text = []byte(s)
+		}
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText(text); err != nil {
+			return reflect.Value{}, true, err
+		}
+		return ptr.Elem(), true, nil
+	case pt.Implements(jsonUnmarshalerType):
+		ptr := reflect.New(t)
+		b, err := json.Marshal(confValue)
+		if err != nil {
+			return reflect.Value{}, true, err
+		}
+		if err := ptr.Interface().(json.Unmarshaler).UnmarshalJSON(b); err != nil {
+			return reflect.Value{}, true, err
+		}
+		return ptr.Elem(), true, nil
+	}
+	return reflect.Value{}, false, nil
+}
+
+// assignableValue returns the value of v which can be assigned to type t,
+// a pointer is dereferenced if t is not a pointer type.
+func assignableValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return reflect.New(t).Elem(), nil
+	}
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Type().AssignableTo(t) {
+		return rv.Elem(), nil
+	}
+	if rv.Type().ConvertibleTo(t) {
+		return rv.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("decoder returns %s, can not assign to %s", rv.Type(), t)
+}
+
+func decodeDuration(value interface{}) (interface{}, error) {
+	return cast.ToDurationE(value)
+}
+
+func decodeTime(value interface{}) (interface{}, error) {
+	return cast.ToTimeE(value)
+}
+
+func decodeURL(value interface{}) (interface{}, error) {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(s)
+}
+
+func decodeIPNet(value interface{}) (interface{}, error) {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return nil, err
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return ipNet, nil
+}
+
+func decodeRegexp(value interface{}) (interface{}, error) {
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(s)
+}
@@ -0,0 +1,126 @@
+// Package defaults provides a config source holding the default values of an application,
+// it has the lowest priority, so any other source overrides its values.
+package defaults
+
+import (
+	"sync"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/source"
+)
+
+// const.
+const (
+	Name = "DefaultsSource"
+	// Priority is the source priority of the defaults source, below all the other built-in sources.
+	Priority = 10
+)
+
+// Source is the defaults config source,
+// its values are only changed by AddDefaults, Set and Delete of the manager do not touch it.
+type Source struct {
+	sync.RWMutex
+	configs  map[string]interface{}
+	callback source.EventHandler
+	priority int
+}
+
+// NewDefaultsSource creates a defaults config source.
+func NewDefaultsSource() *Source {
+	return &Source{
+		configs:  make(map[string]interface{}),
+		priority: Priority,
+	}
+}
+
+// AddDefaults merges key values into the defaults, the new values replace the existing ones.
+func (s *Source) AddDefaults(kvs map[string]interface{}) error {
+	s.Lock()
+	events := make([]*event.Event, 0, len(kvs))
+	for key, value := range kvs {
+		e := &event.Event{EventSource: Name, Key: key, Value: value, EventType: event.Create}
+		if _, ok := s.configs[key]; ok {
+			e.EventType = event.Update
+		}
+		s.configs[key] = value
+		events = append(events, e)
+	}
+	callback := s.callback
+	s.Unlock()
+
+	if callback != nil && len(events) > 0 {
+		for _, e := range events {
+			callback.OnEvent(e)
+		}
+		callback.OnModuleEvent(events)
+	}
+	return nil
+}
+
+// GetConfigurations gets all defaults.
+func (s *Source) GetConfigurations() (map[string]interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+	configs := make(map[string]interface{}, len(s.configs))
+	for k, v := range s.configs {
+		configs[k] = v
+	}
+	return configs, nil
+}
+
+// GetConfigurationByKey gets the default of a key.
+func (s *Source) GetConfigurationByKey(key string) (interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+	value, ok := s.configs[key]
+	if !ok {
+		return nil, source.ErrKeyNotExist
+	}
+	return value, nil
+}
+
+// Watch keeps the callback which AddDefaults notifies.
+func (s *Source) Watch(callback source.EventHandler) error {
+	s.Lock()
+	defer s.Unlock()
+	s.callback = callback
+	return nil
+}
+
+// GetPriority returns priority of the defaults source.
+func (s *Source) GetPriority() int {
+	return s.priority
+}
+
+// SetPriority custom priority.
+func (s *Source) SetPriority(priority int) {
+	s.priority = priority
+}
+
+// GetSourceName returns name of the defaults source.
+func (*Source) GetSourceName() string {
+	return Name
+}
+
+// Cleanup removes all defaults.
+func (s *Source) Cleanup() error {
+	s.Lock()
+	defer s.Unlock()
+	s.configs = make(map[string]interface{})
+	return nil
+}
+
+// AddDimensionInfo is none function.
+func (*Source) AddDimensionInfo(_ map[string]string) error {
+	return nil
+}
+
+// Set is none function, defaults are only changed by AddDefaults.
+func (*Source) Set(_ string, _ interface{}) error {
+	return nil
+}
+
+// Delete is none function, defaults are only changed by AddDefaults.
+func (*Source) Delete(_ string) error {
+	return nil
+}
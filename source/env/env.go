@@ -24,12 +24,15 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/arielsrv/go-archaius/event"
 	"github.com/arielsrv/go-archaius/source"
 )
 
+// const.
 const (
-	envSourceConst            = "EnvironmentSource"
-	envVariableSourcePriority = 3
+	Name = "EnvironmentSource"
+	// Priority is the source priority of the env source.
+	Priority = 3
 )
 
 // Source is a struct.
@@ -42,7 +45,7 @@ type Source struct {
 func NewEnvConfigurationSource() source.ConfigSource {
 	logrus.Info("enable env source")
 	envConfigSource := new(Source)
-	envConfigSource.priority = envVariableSourcePriority
+	envConfigSource.priority = Priority
 	envConfigSource.pullConfigurations()
 	return envConfigSource
 }
@@ -54,7 +57,8 @@ func (es *Source) pullConfigurations() {
 		in := strings.Index(value, "=")
 		key := string(rs[0:in])
 		value := string(rs[in+1:])
-		envKey := strings.Replace(key, "_", ".", -1)
+		// APP_DB_HOST is also kept as APP.DB.HOST, the manager converts . into its key separator
+		envKey := strings.Replace(key, "_", event.DefaultSeparator, -1)
 		es.Configs.Store(key, value)
 		es.Configs.Store(envKey, value)
 	}
@@ -93,7 +97,7 @@ func (es *Source) SetPriority(priority int) {
 
 // GetSourceName returns the name of environment source.
 func (*Source) GetSourceName() string {
-	return envSourceConst
+	return Name
 }
 
 // Watch dynamically handles a environment configuration.
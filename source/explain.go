@@ -0,0 +1,68 @@
+package source
+
+import (
+	"sort"
+)
+
+// OriginGetter is implemented by a source which can tell where the value of a key comes from,
+// like the file of the file source.
+type OriginGetter interface {
+	GetConfigurationOrigin(key string) (string, error)
+}
+
+// Explanation tells where the value of a key comes from.
+type Explanation struct {
+	Key string
+	// Value is the raw value of the key, masked for a sensitive key
+	Value  interface{}
+	Source string
+	// Origin is where the source got the value, empty if the source can not tell
+	Origin string
+	// Candidates are the values of the key in every source holding it, by precedence
+	Candidates []Candidate
+}
+
+// Candidate is the value of a key in one source.
+type Candidate struct {
+	Source   string
+	Priority int
+	Origin   string
+	Value    interface{}
+}
+
+// Explain tells which source provides the value of key, and what the other sources hold for it.
+func (m *Manager) Explain(key string) (*Explanation, error) {
+	key, _ = m.aliasedKey(m.canonicalKey(key))
+	sourceName, ok := m.ConfigurationMap.Load(key)
+	if !ok {
+		return nil, ErrKeyNotExist
+	}
+	e := &Explanation{Key: key, Source: sourceName.(string)}
+
+	m.sourceMapMux.RLock()
+	for name, s := range m.Sources {
+		v, err := s.GetConfigurationByKey(key)
+		if err != nil {
+			continue
+		}
+		c := Candidate{Source: name, Priority: s.GetPriority(), Value: m.redactor.Value(key, v)}
+		if og, ok := s.(OriginGetter); ok {
+			c.Origin, _ = og.GetConfigurationOrigin(key)
+		}
+		e.Candidates = append(e.Candidates, c)
+	}
+	m.sourceMapMux.RUnlock()
+
+	sort.Slice(e.Candidates, func(i, j int) bool {
+		if e.Candidates[i].Priority != e.Candidates[j].Priority {
+			return e.Candidates[i].Priority < e.Candidates[j].Priority
+		}
+		return e.Candidates[i].Source < e.Candidates[j].Source
+	})
+	for _, c := range e.Candidates {
+		if c.Source == e.Source {
+			e.Value, e.Origin = c.Value, c.Origin
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,234 @@
+package filesource
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/source/util"
+)
+
+// DirOptions decide which files of a directory are managed, and how they rank among the files of the same priority.
+type DirOptions struct {
+	// Recursive manages the files in the sub directories too
+	Recursive bool
+	// Include and Exclude are glob patterns, ** matches any number of directories,
+	// a pattern with a / matches the path relative to the directory, otherwise the file name.
+	// a file is managed if it matches any Include pattern, or Include is empty, and no Exclude pattern.
+	Include []string
+	Exclude []string
+	// Layer orders the files of the same priority, the lower the higher the precedence, 0 by default
+	Layer uint32
+}
+
+// DirOption is a func.
+type DirOption func(options *DirOptions)
+
+// Recursive manages the files in the sub directories too.
+func Recursive() DirOption {
+	return func(options *DirOptions) {
+		options.Recursive = true
+	}
+}
+
+// Include manages only the files matching one of the patterns.
+func Include(patterns ...string) DirOption {
+	return func(options *DirOptions) {
+		options.Include = append(options.Include, patterns...)
+	}
+}
+
+// Exclude ignores the files matching one of the patterns.
+func Exclude(patterns ...string) DirOption {
+	return func(options *DirOptions) {
+		options.Exclude = append(options.Exclude, patterns...)
+	}
+}
+
+// Layer ranks the files among the ones of the same priority, like the profile files overriding a file,
+// without changing the priority reported by FilePriorities, FileRanks reports both.
+func Layer(layer uint32) DirOption {
+	return func(options *DirOptions) {
+		options.Layer = layer
+	}
+}
+
+// dir is a directory added to the file source,
+// its files matching the options are managed, also the ones created later.
+type dir struct {
+	root     string
+	priority uint32
+	handler  util.FileHandler
+	opts     DirOptions
+}
+
+// file returns a file of the directory, ranked like the directory.
+func (d *dir) file(filePath string) file {
+	return file{filePath: filePath, priority: d.priority, layer: d.opts.Layer}
+}
+
+// splitGlob splits a path like /etc/conf.d/**/*.yaml into the directory without pattern and the pattern,
+// the pattern is empty if p has no glob characters.
+func splitGlob(p string) (string, string) {
+	parts := strings.Split(filepath.ToSlash(p), "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[") {
+			return filepath.FromSlash(strings.Join(parts[:i], "/")), strings.Join(parts[i:], "/")
+		}
+	}
+	return p, ""
+}
+
+// matchPattern matches a slash separated path with a glob pattern, ** matches any number of directories.
+func matchPattern(pattern, p string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchParts(pattern[1:], parts[1:])
+}
+
+// contains tells whether the files of directory dirPath belong to d.
+func (d *dir) contains(dirPath string) bool {
+	if dirPath == d.root {
+		return true
+	}
+	rel, err := filepath.Rel(d.root, dirPath)
+	if !d.opts.Recursive || err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return !hidden(filepath.ToSlash(rel))
+}
+
+// matches tells whether filePath is managed by d, the hidden files are never managed,
+// nor the files without FileHandler for their extension if d has no FileHandler.
+func (d *dir) matches(filePath string) bool {
+	if !d.contains(filepath.Dir(filePath)) || hidden(filepath.Base(filePath)) {
+		return false
+	}
+	if d.handler == nil && !util.HasFileHandler(filePath) {
+		return false
+	}
+	rel, err := filepath.Rel(d.root, filePath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	match := func(pattern string) bool {
+		if strings.Contains(pattern, "/") {
+			return matchPattern(pattern, rel)
+		}
+		return matchPattern(pattern, path.Base(rel))
+	}
+	included := len(d.opts.Include) == 0
+	for _, pattern := range d.opts.Include {
+		included = included || match(pattern)
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range d.opts.Exclude {
+		if match(pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// hidden tells whether a slash separated path has a part starting with a dot, like the ..data of kubernetes.
+func hidden(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// walk returns the directories to watch and the files managed by d.
+func (d *dir) walk() ([]string, []string, error) {
+	var dirs, files []string
+	err := filepath.WalkDir(d.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if !d.contains(p) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, p)
+			return nil
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !entry.Type().IsRegular() {
+			return nil
+		}
+		if d.matches(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return dirs, files, err
+}
+
+// dirOf returns the first added directory managing filePath, nil if none.
+func (fSource *Source) dirOf(filePath string) *dir {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	for _, d := range fSource.dirs {
+		if d.matches(filePath) {
+			return d
+		}
+	}
+	return nil
+}
+
+// containingDir returns the first recursive directory containing the directory dirPath, nil if none.
+func (fSource *Source) containingDir(dirPath string) *dir {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	for _, d := range fSource.dirs {
+		if d.opts.Recursive && d.contains(dirPath) {
+			return d
+		}
+	}
+	return nil
+}
+
+// watchedDirs returns the directories of all added directories.
+func (fSource *Source) watchedDirs() []string {
+	fSource.RLock()
+	dirs := append([]*dir(nil), fSource.dirs...)
+	fSource.RUnlock()
+	result := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		watched, _, err := d.walk()
+		if err != nil {
+			continue
+		}
+		result = append(result, watched...)
+	}
+	return result
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/redact"
 	"github.com/arielsrv/go-archaius/source"
 	"github.com/arielsrv/go-archaius/source/util"
 	"github.com/fsnotify/fsnotify"
@@ -39,9 +40,13 @@ import (
 const (
 	//FileConfigSourceConst is a variable of type string.
 	FileConfigSourceConst = "FileSource"
-	fileSourcePriority    = 4
+	// FileSourcePriority is the source priority of the file source unless WithPriority is given.
+	FileSourcePriority = 4
 	//DefaultFilePriority is a variable of type string.
 	DefaultFilePriority = 0
+	// removeDelay is how long a removed file may take to come back before its key values are dropped,
+	// like a file replaced by a remove and a create.
+	removeDelay = time.Second
 )
 
 // FileSourceTypes is a string.
@@ -67,23 +72,48 @@ type Source struct {
 	Configurations map[string]*ConfigInfo
 	files          []file
 	fileHandlers   map[string]util.FileHandler
+	includes       map[string][]string
+	dirs           []*dir
 	watchPool      *watch
-	filelock       sync.Mutex
 	priority       int
 	sync.RWMutex
+
+	// fileConfigs holds the key values of each file, the ones not taking effect too
+	fileConfigs map[string]map[string]interface{}
+	// missing holds the removed files with their priority, they are added again once they come back
+	missing map[string]file
+	// links holds the file each file resolves to through symlinks
+	links *util.Links
+	opts  Options
 }
 
 type file struct {
 	filePath string
 	priority uint32
+	// layer orders the files of the same priority
+	layer uint32
+}
+
+// precedes tells whether the values of f override the ones of other, by priority then by layer.
+func (f file) precedes(other file) bool {
+	if f.priority != other.priority {
+		return f.priority < other.priority
+	}
+	return f.layer < other.layer
 }
 
 type watch struct {
 	//files   []string
 	watcher    *fsnotify.Watcher
+	poller     *poller
 	callback   source.EventHandler
 	fileSource *Source
 	sync.RWMutex
+
+	// done is closed when the watch stops, wg waits for its goroutines
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 /*
@@ -97,24 +127,57 @@ type watch struct {
 // FileSource is a interface.
 type FileSource interface {
 	source.ConfigSource
-	AddFile(filePath string, priority uint32, handler util.FileHandler) error
+	AddFile(filePath string, priority uint32, handler util.FileHandler, opts ...DirOption) error
+	// FilePriorities returns the priority applied to each managed file, the lower the higher the precedence
+	FilePriorities() map[string]uint32
+	// FileRanks returns the priority and the layer applied to each managed file
+	FileRanks() map[string]FileRank
+}
+
+// FileRank is the precedence applied to a file, the files are ordered by priority then by layer,
+// the lower the higher the precedence.
+type FileRank struct {
+	Priority uint32
+	Layer    uint32
 }
 
-// NewFileSource creates a source which can handler local files.
-func NewFileSource() FileSource {
+// NewFileSource creates a source which can handler local files,
+// the changes are watched by fsnotify, and polled where fsnotify does not work.
+func NewFileSource(opts ...Option) FileSource {
 	fileConfigSource := new(Source)
-	fileConfigSource.priority = fileSourcePriority
+	fileConfigSource.opts = Options{Name: FileConfigSourceConst, Priority: FileSourcePriority,
+		WatchMode: WatchAuto, PollInterval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(&fileConfigSource.opts)
+	}
+	fileConfigSource.priority = fileConfigSource.opts.Priority
 	fileConfigSource.files = make([]file, 0)
 	fileConfigSource.fileHandlers = make(map[string]util.FileHandler)
+	fileConfigSource.includes = make(map[string][]string)
+	fileConfigSource.fileConfigs = make(map[string]map[string]interface{})
+	fileConfigSource.missing = make(map[string]file)
+	fileConfigSource.links = util.NewLinks()
 	return fileConfigSource
 }
 
 // AddFile add file and manage configs.
-func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandler) error {
+// a directory manages its files chosen by opts, a path with glob patterns like conf.d/**/*.yaml
+// manages the matching files of the directory before the first pattern.
+// the files created in a directory later are managed too.
+func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandler, opts ...DirOption) error {
 	path, err := filepath.Abs(p)
 	if err != nil {
 		return err
 	}
+	o := DirOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if base, pattern := splitGlob(path); pattern != "" {
+		path = base
+		o.Include = append(o.Include, pattern)
+		o.Recursive = o.Recursive || strings.Contains(pattern, "/")
+	}
 	// check existence of file
 	fs, err := os.Open(path)
 	if os.IsNotExist(err) {
@@ -126,19 +189,23 @@ func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandle
 	if fSource.isFileSrcExist(path) {
 		return nil
 	}
+	fSource.Lock()
 	fSource.fileHandlers[path] = handle
+	fSource.Unlock()
 	fileType := fileType(fs)
 	switch fileType {
 	case Directory:
-		// handle Directory input. Include all files as file source.
-		err := fSource.handleDirectory(fs, priority, handle)
+		// handle Directory input. Include the matching files as file source.
+		d := &dir{root: path, priority: priority, handler: handle, opts: o}
+		err := fSource.handleDirectory(d)
 		if err != nil {
 			logrus.Error(fmt.Sprintf("Failed to handle directory [%s] %s", path, err))
 			return err
 		}
+		return nil
 	case RegularFile:
 		// handle file and include as file source.
-		err := fSource.handleFile(fs, priority, handle)
+		err := fSource.handleFile(file{filePath: path, priority: priority, layer: o.Layer}, handle)
 		if err != nil {
 			logrus.Error(fmt.Sprintf("Failed to handle file [%s] [%s]", path, err))
 			return err
@@ -148,21 +215,18 @@ func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandle
 		return fmt.Errorf("file type of [%s] not supported", path)
 	}
 
-	if fSource.watchPool != nil {
-		fSource.watchPool.AddWatchFile(path)
-	}
-
 	return nil
 }
 
 func (fSource *Source) isFileSrcExist(filePath string) bool {
-	var exist bool
+	fSource.RLock()
+	defer fSource.RUnlock()
 	for _, file := range fSource.files {
 		if filePath == file.filePath {
 			return true
 		}
 	}
-	return exist
+	return false
 }
 
 func fileType(fs *os.File) FileSourceTypes {
@@ -182,91 +246,265 @@ func fileType(fs *os.File) FileSourceTypes {
 	return InvalidFileType
 }
 
-func (fSource *Source) handleDirectory(dir *os.File, priority uint32, handle util.FileHandler) error {
-	filesInfo, err := dir.Readdir(-1)
+func (fSource *Source) handleDirectory(d *dir) error {
+	dirs, files, err := d.walk()
 	if err != nil {
-		return errors.New("failed to read Directory contents")
+		return fmt.Errorf("failed to read Directory contents, %s", err)
 	}
-
-	for _, fileInfo := range filesInfo {
-		filePath := filepath.Join(dir.Name(), fileInfo.Name())
-
-		fs, err := os.Open(filePath)
-		if err != nil {
-			logrus.Error(fmt.Sprintf("error in file open for %s file", err.Error()))
-			continue
+	fSource.Lock()
+	replaced := fSource.setDir(d)
+	fSource.Unlock()
+	if replaced != nil {
+		for _, filePath := range fSource.unmanagedFiles(replaced) {
+			fSource.removeFile(filePath)
 		}
+	}
 
-		err = fSource.handleFile(fs, priority, handle)
+	for _, filePath := range files {
+		err = fSource.handleFile(d.file(filePath), d.handler)
 		if err != nil {
-			logrus.Error(fmt.Sprintf("error processing %s file source handler with error : %s ", fs.Name(),
+			logrus.Error(fmt.Sprintf("error processing %s file source handler with error : %s ", filePath,
 				err.Error()))
 		}
-		fs.Close()
+	}
+	if wth := fSource.watching(); wth != nil {
+		for _, p := range dirs {
+			wth.AddWatchFile(p)
+		}
 	}
 
 	return nil
 }
 
-func (fSource *Source) handleFile(file *os.File, priority uint32, handle util.FileHandler) error {
-	Content, err := os.ReadFile(file.Name())
-	if err != nil {
-		return err
+// setDir adds d, or replaces the directory of the same root so that the options of d apply,
+// it returns the replaced directory, nil if none. it must be called with the lock held.
+func (fSource *Source) setDir(d *dir) *dir {
+	for i, added := range fSource.dirs {
+		if added.root == d.root {
+			fSource.dirs[i] = d
+			return added
+		}
 	}
-	var config map[string]interface{}
-	if handle != nil {
-		config, err = handle(file.Name(), Content)
-	} else {
-		config, err = util.Convert2JavaProps(file.Name(), Content)
+	fSource.dirs = append(fSource.dirs, d)
+	return nil
+}
+
+// unmanagedFiles returns the files of the replaced directory which are not managed anymore,
+// neither by a directory nor added by themselves.
+func (fSource *Source) unmanagedFiles(replaced *dir) []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	var result []string
+	for _, f := range fSource.files {
+		if _, ok := fSource.fileHandlers[f.filePath]; ok || !replaced.matches(f.filePath) {
+			continue
+		}
+		managed := false
+		for _, d := range fSource.dirs {
+			managed = managed || d.matches(f.filePath)
+		}
+		if !managed {
+			result = append(result, f.filePath)
+		}
 	}
+	return result
+}
+
+func (fSource *Source) handleFile(f file, handle util.FileHandler) error {
+	filePath := f.filePath
+	if handle == nil {
+		handle = util.FileHandlerFor(filePath)
+	}
+	config, err := fSource.loadFile(filePath, handle)
 	if err != nil {
-		return fmt.Errorf("failed to pull configurations from [%s] file, %s", file.Name(), err)
+		return fmt.Errorf("failed to pull configurations from [%s] file, %s", filePath, err)
 	}
 
-	err = fSource.handlePriority(file.Name(), priority)
+	err = fSource.handlePriority(f)
 	if err != nil {
-		return fmt.Errorf("failed to handle priority of [%s], %s", file.Name(), err)
+		return fmt.Errorf("failed to handle priority of [%s], %s", filePath, err)
 	}
+	fSource.watchPath(filePath)
 
-	events := fSource.compareUpdate(config, file.Name())
-	if fSource.watchPool != nil && fSource.watchPool.callback != nil { // if file source already added and try to add
+	events := fSource.compareUpdate(config, filePath)
+	if wth := fSource.watching(); wth != nil && wth.callback != nil { // if file source already added and try to add
 		for _, e := range events {
-			fSource.watchPool.callback.OnEvent(e)
+			wth.callback.OnEvent(e)
 		}
-		fSource.watchPool.callback.OnModuleEvent(events)
+		wth.callback.OnModuleEvent(events)
 	}
 
 	return nil
 }
 
-func (fSource *Source) handlePriority(filePath string, priority uint32) error {
+// removeDirFiles drops the key values of the files of directories under p, or p itself,
+// which do not exist anymore, it tells whether there were any.
+func (fSource *Source) removeDirFiles(p string) bool {
+	fSource.RLock()
+	var removed []string
+	for _, f := range fSource.files {
+		if !within(p, f.filePath) {
+			continue
+		}
+		if _, err := os.Stat(f.filePath); err == nil {
+			continue
+		}
+		for _, d := range fSource.dirs {
+			if d.matches(f.filePath) {
+				removed = append(removed, f.filePath)
+				break
+			}
+		}
+	}
+	fSource.RUnlock()
+	for _, f := range removed {
+		fSource.removeFile(f)
+	}
+	return len(removed) > 0
+}
+
+// removeFile drops the key values of a file which is not managed anymore,
+// a key defined by other files falls back to the one of highest precedence.
+// it returns the removed file.
+func (fSource *Source) removeFile(filePath string) file {
+	events := make([]*event.Event, 0)
+	removed := file{filePath: filePath, priority: math.MaxUint32}
+	fSource.Lock()
+	files := make([]file, 0, len(fSource.files))
+	for _, f := range fSource.files {
+		if f.filePath != filePath {
+			files = append(files, f)
+			continue
+		}
+		removed = f
+	}
+	fSource.files = files
+	delete(fSource.includes, filePath)
+	delete(fSource.fileConfigs, filePath)
+	for key, confInfo := range fSource.Configurations {
+		if confInfo == nil || confInfo.FilePath != filePath {
+			continue
+		}
+		if fallback := fSource.fallback(key, filePath); fallback != nil {
+			fSource.Configurations[key] = fallback
+			events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
+				EventType: event.Update, Value: fallback.Value})
+			continue
+		}
+		delete(fSource.Configurations, key)
+		events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
+			EventType: event.Delete, Value: confInfo.Value})
+	}
+	fSource.Unlock()
+	fSource.links.Untrack(filePath)
+
+	if wth := fSource.watching(); len(events) > 0 && wth != nil && wth.callback != nil {
+		for _, e := range events {
+			wth.callback.OnEvent(e)
+		}
+		wth.callback.OnModuleEvent(events)
+	}
+	return removed
+}
+
+// fallback returns the value of key in the file of highest precedence other than filePath, nil if none,
+// it must be called with the lock held.
+func (fSource *Source) fallback(key, filePath string) *ConfigInfo {
+	var result *ConfigInfo
+	var best file
+	for _, f := range fSource.files {
+		if f.filePath == filePath || (result != nil && !f.precedes(best)) {
+			continue
+		}
+		if v, ok := fSource.fileConfigs[f.filePath][key]; ok {
+			result = &ConfigInfo{FilePath: f.filePath, Value: v}
+			best = f
+		}
+	}
+	return result
+}
+
+// markMissing remembers a removed file so that it is added again once it comes back.
+func (fSource *Source) markMissing(f file) {
+	fSource.Lock()
+	defer fSource.Unlock()
+	fSource.missing[f.filePath] = f
+}
+
+// missingFile returns a removed file with its priority.
+func (fSource *Source) missingFile(filePath string) (file, bool) {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	f, ok := fSource.missing[filePath]
+	return f, ok
+}
+
+// fileHandler returns the FileHandler given to AddFile for the file or its directory,
+// or the one registered for the extension of the file.
+func (fSource *Source) fileHandler(filePath string) util.FileHandler {
+	fSource.RLock()
+	handle := fSource.fileHandlers[filePath]
+	fSource.RUnlock()
+	if handle != nil {
+		return handle
+	}
+	if d := fSource.dirOf(filePath); d != nil && d.handler != nil {
+		return d.handler
+	}
+	logrus.Debug("use the file handler of the file extension")
+	return util.FileHandlerFor(filePath)
+}
+
+func (fSource *Source) handlePriority(added file) error {
 	fSource.Lock()
 	newFilePriority := make([]file, 0)
 	var prioritySet bool
 	for _, f := range fSource.files {
-		if f.filePath == filePath && f.priority == priority {
+		if f.filePath == added.filePath {
+			if prioritySet {
+				continue
+			}
 			prioritySet = true
-			newFilePriority = append(newFilePriority, file{
-				filePath: filePath,
-				priority: priority,
-			})
+			f = added
 		}
 		newFilePriority = append(newFilePriority, f)
 	}
 
 	if !prioritySet {
-		newFilePriority = append(newFilePriority, file{
-			filePath: filePath,
-			priority: priority,
-		})
+		newFilePriority = append(newFilePriority, added)
 	}
 
 	fSource.files = newFilePriority
+	delete(fSource.missing, added.filePath)
 	fSource.Unlock()
 
 	return nil
 }
 
+// FilePriorities returns the absolute path and the priority of each managed file,
+// the files of a directory take the priority of the directory.
+func (fSource *Source) FilePriorities() map[string]uint32 {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	priorities := make(map[string]uint32, len(fSource.files))
+	for _, f := range fSource.files {
+		priorities[f.filePath] = f.priority
+	}
+	return priorities
+}
+
+// FileRanks returns the absolute path and the rank of each managed file,
+// like a profile file ranking above the file it overlays by layer with the same priority.
+func (fSource *Source) FileRanks() map[string]FileRank {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	ranks := make(map[string]FileRank, len(fSource.files))
+	for _, f := range fSource.files {
+		ranks[f.filePath] = FileRank{Priority: f.priority, Layer: f.layer}
+	}
+	return ranks
+}
+
 // GetConfigurations get all configs.
 func (fSource *Source) GetConfigurations() (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
@@ -303,9 +541,19 @@ func (fSource *Source) GetConfigurationByKey(key string) (interface{}, error) {
 	return nil, source.ErrKeyNotExist
 }
 
+// GetConfigurationOrigin returns the file providing the value of key.
+func (fSource *Source) GetConfigurationOrigin(key string) (string, error) {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	if confInfo, ok := fSource.Configurations[key]; ok && confInfo != nil {
+		return confInfo.FilePath, nil
+	}
+	return "", source.ErrKeyNotExist
+}
+
 // GetSourceName get name of source.
-func (*Source) GetSourceName() string {
-	return FileConfigSourceConst
+func (fSource *Source) GetSourceName() string {
+	return fSource.opts.Name
 }
 
 // GetPriority get precedence.
@@ -329,122 +577,285 @@ func (fSource *Source) Watch(callback source.EventHandler) error {
 		return err
 	}
 
+	// added before the watch is visible to Cleanup, which waits for it
+	watchPool.wg.Add(1)
+	fSource.Lock()
 	fSource.watchPool = watchPool
+	fSource.Unlock()
 
-	go fSource.watchPool.startWatchPool()
+	go watchPool.startWatchPool()
 
 	return nil
 }
 
 func newWatchPool(callback source.EventHandler, cfgSrc *Source) (*watch, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		logrus.Error("New file watcher failed:" + err.Error())
-		return nil, err
-	}
-
 	watch := new(watch)
 	watch.callback = callback
 	watch.fileSource = cfgSrc
-	watch.watcher = watcher
-	logrus.Info("create new watcher")
+	watch.done = make(chan struct{})
+	mode := cfgSrc.opts.WatchMode
+	if mode != WatchPoll {
+		watcher, err := fsnotify.NewWatcher()
+		switch {
+		case err == nil:
+			watch.watcher = watcher
+			logrus.Info("create new watcher")
+		case mode == WatchNotify:
+			logrus.Error("New file watcher failed:" + err.Error())
+			return nil, err
+		default:
+			logrus.Warn("New file watcher failed, poll the files instead:" + err.Error())
+		}
+	}
+	if mode != WatchNotify {
+		watch.poller = newPoller(cfgSrc.opts.PollInterval, cfgSrc.tracked)
+		logrus.Info(fmt.Sprintf("poll the files every %s", watch.poller.interval))
+	}
 	return watch, nil
 }
 
 func (wth *watch) startWatchPool() {
+	defer wth.wg.Done()
+	wth.wg.Add(1)
 	go wth.watchFile()
-	for _, file := range wth.fileSource.files {
-		f, err := filepath.Abs(file.filePath)
-		if err != nil {
-			logrus.Error(fmt.Sprintf("failed to get Directory info from: %s file: %s", file.filePath, err))
-			return
+	if wth.poller != nil {
+		wth.wg.Add(1)
+		go func() {
+			defer wth.wg.Done()
+			wth.poller.start()
+		}()
+	}
+	for _, filePath := range wth.fileSource.filePaths() {
+		for _, d := range wth.fileSource.links.Track(filePath) {
+			wth.AddWatchFile(d)
 		}
+	}
+	for _, f := range wth.fileSource.includedFiles() {
+		wth.AddWatchFile(filepath.Dir(f))
+	}
+	for _, d := range wth.fileSource.watchedDirs() {
+		wth.AddWatchFile(d)
+	}
+}
 
-		err = wth.watcher.Add(f)
-		if err != nil {
-			logrus.Error(fmt.Sprintf("add watcher file: %+v fail %s", file, err))
-			return
+// stop closes the watcher and the poller, and waits for the goroutines of the watch to exit.
+func (wth *watch) stop() {
+	wth.stopOnce.Do(func() {
+		close(wth.done)
+		if wth.watcher != nil {
+			wth.watcher.Close()
 		}
-	}
+		if wth.poller != nil {
+			wth.poller.close()
+		}
+	})
+	wth.wg.Wait()
 }
 
+// AddWatchFile watches filePath by fsnotify, it is polled instead if fsnotify fails,
+// like when the inotify watches run out.
 func (wth *watch) AddWatchFile(filePath string) {
-	err := wth.watcher.Add(filePath)
-	if err != nil {
-		logrus.Error(fmt.Sprintf("add watcher file: %s fail: %s", filePath, err))
+	select {
+	case <-wth.done:
 		return
+	default:
+	}
+	if wth.watcher != nil {
+		err := wth.watcher.Add(filePath)
+		if err == nil {
+			return
+		}
+		if wth.poller == nil {
+			logrus.Error(fmt.Sprintf("add watcher file: %s fail: %s", filePath, err))
+			return
+		}
+		logrus.Warn(fmt.Sprintf("add watcher file: %s fail: %s, poll it instead", filePath, err))
+	}
+	if err := wth.poller.add(filePath); err != nil {
+		logrus.Error(fmt.Sprintf("poll file: %s fail: %s", filePath, err))
 	}
 }
 
 func (wth *watch) watchFile() {
+	defer wth.wg.Done()
+	var events, polled <-chan fsnotify.Event
+	var errs <-chan error
+	if wth.watcher != nil {
+		events, errs = wth.watcher.Events, wth.watcher.Errors
+	}
+	if wth.poller != nil {
+		polled = wth.poller.events
+	}
 	for {
 		select {
-		case event, ok := <-wth.watcher.Events:
+		case event, ok := <-events:
 			if !ok {
 				logrus.Warn("file watcher stop")
 				return
 			}
+			wth.handleEvent(event)
 
-			if strings.HasSuffix(event.Name, ".swx") || strings.HasSuffix(event.Name, ".swp") || strings.HasSuffix(event.Name, "~") {
-				//ignore
-				continue
+		case event, ok := <-polled:
+			if !ok {
+				logrus.Warn("file poller stop")
+				return
 			}
-			logrus.Debug(fmt.Sprintf("file event %s, operation is %d. reload it.", event.Name, event.Op))
+			wth.handleEvent(event)
 
-			if event.Op == fsnotify.Remove {
-				logrus.Warn(fmt.Sprintf("the file change mode: %s, continue", event.String()))
-				continue
+		case err, ok := <-errs:
+			if !ok {
+				logrus.Warn("file watcher stop")
+				return
 			}
+			wth.watchError(err)
+		}
+	}
+}
 
-			if event.Op == fsnotify.Rename {
-				logrus.Debug("file renamed")
-				wth.watcher.Remove(event.Name)
-				// check existence of file
-				_, err := os.Open(event.Name)
-				if os.IsNotExist(err) {
-					logrus.Warn(fmt.Sprintf("[%s] file does not exist so not able to watch further:%s", event.Name, err))
-				} else {
-					wth.AddWatchFile(event.Name)
-				}
+// watchError logs an error of fsnotify, like an overflow of its event queue,
+// the paths watched by fsnotify are polled instead in WatchAuto.
+func (wth *watch) watchError(err error) {
+	if wth.poller == nil {
+		logrus.Error(fmt.Sprintf("watch file error: %s", err))
+		return
+	}
+	logrus.Warn(fmt.Sprintf("watch file error: %s, poll the files instead", err))
+	for _, p := range wth.watcher.WatchList() {
+		if err := wth.poller.add(p); err != nil {
+			logrus.Error(fmt.Sprintf("poll file: %s fail: %s", p, err))
+			continue
+		}
+		if err := wth.watcher.Remove(p); err != nil {
+			logrus.Debug(fmt.Sprintf("remove watcher file: %s fail: %s", p, err))
+		}
+	}
+}
 
-				continue
-			}
+// handleEvent reloads the files changed by a file event of fsnotify or of the poller.
+func (wth *watch) handleEvent(event fsnotify.Event) {
+	if strings.HasSuffix(event.Name, ".swx") || strings.HasSuffix(event.Name, ".swp") || strings.HasSuffix(event.Name, "~") {
+		//ignore
+		return
+	}
+	logrus.Debug(fmt.Sprintf("file event %s, operation is %d. reload it.", event.Name, event.Op))
 
-			if event.Op == fsnotify.Create {
-				logrus.Debug("file created")
-				time.Sleep(time.Millisecond)
-			}
-			handle := wth.fileSource.fileHandlers[event.Name]
-			if handle == nil {
-				logrus.Debug("user default file handler")
-				handle = util.Convert2JavaProps
-			}
-			content, err := os.ReadFile(event.Name)
-			if err != nil {
-				logrus.Error("read file error " + err.Error())
-				continue
-			}
+	// a symlink swap like the ..data of kubernetes, or a write to the target of a symlink,
+	// reloads the files resolving to the changed file
+	for _, f := range wth.fileSource.links.Changed(event.Name) {
+		wth.reload(f)
+	}
 
-			newConf, err := handle(event.Name, content)
-			if err != nil {
-				logrus.Error("convert error " + err.Error())
-				continue
-			}
-			logrus.Debug(fmt.Sprintf("new config: %v", newConf))
-			events := wth.fileSource.compareUpdate(newConf, event.Name)
-			logrus.Debug(fmt.Sprintf("generated events %v", events))
-			if len(events) > 0 { //avoid OnModuleEvent empty events error
-				for _, e := range events {
-					wth.callback.OnEvent(e)
-				}
-				wth.callback.OnModuleEvent(events)
+	if event.Op == fsnotify.Remove || event.Op == fsnotify.Rename {
+		name := event.Name
+		time.AfterFunc(removeDelay, func() {
+			if wth.fileSource.removeDirFiles(name) {
+				logrus.Debug(fmt.Sprintf("[%s] removed from directory", name))
+				return
 			}
+			wth.removed(name)
+		})
+		return
+	}
 
-		case err := <-wth.watcher.Errors:
-			logrus.Debug(fmt.Sprintf("watch file error: %s", err))
+	if event.Op == fsnotify.Create {
+		logrus.Debug("file created")
+		time.Sleep(time.Millisecond)
+		if wth.addCreatedDir(event.Name) {
 			return
 		}
 	}
+	// a new file of a directory is managed, an existing one is reloaded
+	if d := wth.fileSource.dirOf(event.Name); d != nil && !wth.fileSource.isFileSrcExist(event.Name) {
+		if err := wth.fileSource.handleFile(d.file(event.Name), d.handler); err != nil {
+			logrus.Error(err.Error())
+		}
+		return
+	}
+	// a removed file coming back is added again
+	if f, ok := wth.fileSource.missingFile(event.Name); ok {
+		logrus.Info(fmt.Sprintf("[%s] file is back", event.Name))
+		if err := wth.fileSource.handleFile(f, wth.fileSource.fileHandler(event.Name)); err != nil {
+			logrus.Error(err.Error())
+		}
+		return
+	}
+	// an included file reloads the files including it
+	including := wth.fileSource.includingFiles(event.Name)
+	if wth.fileSource.isFileSrcExist(event.Name) {
+		wth.reload(event.Name)
+	}
+	for _, f := range including {
+		wth.reload(f)
+	}
+}
+
+// removed drops the key values of a removed or renamed file, its directory is watched to know when it comes back,
+// a file replaced by another one is reloaded.
+func (wth *watch) removed(filePath string) {
+	if !wth.fileSource.isFileSrcExist(filePath) {
+		return
+	}
+	if _, err := os.Stat(filePath); err == nil {
+		logrus.Debug(fmt.Sprintf("[%s] file replaced", filePath))
+		wth.reload(filePath)
+		return
+	}
+	logrus.Warn(fmt.Sprintf("[%s] file removed, drop its configurations", filePath))
+	wth.fileSource.markMissing(wth.fileSource.removeFile(filePath))
+}
+
+// addCreatedDir watches a directory created in a recursive directory and manages its files.
+func (wth *watch) addCreatedDir(dirPath string) bool {
+	info, err := os.Stat(dirPath)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	d := wth.fileSource.containingDir(dirPath)
+	if d == nil {
+		return true
+	}
+	dirs, files, err := d.walk()
+	if err != nil {
+		logrus.Error(fmt.Sprintf("failed to read directory [%s], %s", dirPath, err))
+		return true
+	}
+	for _, p := range dirs {
+		if within(dirPath, p) {
+			wth.AddWatchFile(p)
+		}
+	}
+	for _, p := range files {
+		if within(dirPath, p) && !wth.fileSource.isFileSrcExist(p) {
+			if err := wth.fileSource.handleFile(d.file(p), d.handler); err != nil {
+				logrus.Error(err.Error())
+			}
+		}
+	}
+	return true
+}
+
+// within tells whether p is dirPath or under it.
+func within(dirPath, p string) bool {
+	return p == dirPath || strings.HasPrefix(p, dirPath+string(filepath.Separator))
+}
+
+func (wth *watch) reload(filePath string) {
+	handle := wth.fileSource.fileHandler(filePath)
+	newConf, err := wth.fileSource.loadFile(filePath, handle)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("reload file [%s] error %s", filePath, err))
+		return
+	}
+	logrus.Debug(fmt.Sprintf("new config keys: %v", redact.Keys(newConf)))
+	wth.fileSource.watchPath(filePath)
+	events := wth.fileSource.compareUpdate(newConf, filePath)
+	logrus.Debug(fmt.Sprintf("generated events of keys %v", event.Keys(events)))
+	if len(events) > 0 { //avoid OnModuleEvent empty events error
+		for _, e := range events {
+			wth.callback.OnEvent(e)
+		}
+		wth.callback.OnModuleEvent(events)
+	}
 }
 
 func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath string) []*event.Event {
@@ -457,14 +868,14 @@ func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath st
 	fSource.Lock()
 	defer fSource.Unlock()
 
-	var filePathPriority uint32 = math.MaxUint32
-	for _, file := range fSource.files {
-		if file.filePath == filePath {
-			filePathPriority = file.priority
+	var changed *file
+	for i := range fSource.files {
+		if fSource.files[i].filePath == filePath {
+			changed = &fSource.files[i]
 		}
 	}
 
-	if filePathPriority == math.MaxUint32 {
+	if changed == nil {
 		return nil
 	}
 
@@ -479,7 +890,13 @@ func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath st
 		case filePath:
 			newConfValue, ok := configs[key]
 			if !ok {
-				events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
+				if fallback := fSource.fallback(key, filePath); fallback != nil {
+					fileConfs[key] = fallback
+					events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
+						EventType: event.Update, Value: fallback.Value})
+					continue
+				}
+				events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
 					EventType: event.Delete, Value: confInfo.Value})
 				continue
 			} else if reflect.DeepEqual(confInfo.Value, newConfValue) {
@@ -490,7 +907,7 @@ func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath st
 			confInfo.Value = newConfValue
 			fileConfs[key] = confInfo
 
-			events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
+			events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
 				EventType: event.Update, Value: newConfValue})
 
 		default: // configuration file not same
@@ -498,20 +915,21 @@ func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath st
 			// only handle if configuration conflicts between two sources
 			newConfValue, ok := configs[key]
 			if ok {
-				var priority uint32 = math.MaxUint32
-				for _, file := range fSource.files {
-					if file.filePath == confInfo.FilePath {
-						priority = file.priority
+				current := file{priority: math.MaxUint32}
+				for _, f := range fSource.files {
+					if f.filePath == confInfo.FilePath {
+						current = f
 					}
 				}
 
-				if priority == filePathPriority {
+				if !changed.precedes(current) && !current.precedes(*changed) {
 					fileConfs[key] = confInfo
 					logrus.Info(fmt.Sprintf("Two files have same priority. keeping %s value", confInfo.FilePath))
-				} else if filePathPriority < priority { // lower the vale higher is the priority
+				} else if changed.precedes(current) { // lower the vale higher is the priority
 					confInfo.Value = newConfValue
+					confInfo.FilePath = filePath
 					fileConfs[key] = confInfo
-					events = append(events, &event.Event{EventSource: FileConfigSourceConst,
+					events = append(events, &event.Event{EventSource: fSource.GetSourceName(),
 						Key: key, EventType: event.Update, Value: newConfValue})
 				} else {
 					fileConfs[key] = confInfo
@@ -526,6 +944,7 @@ func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath st
 	fileConfs, events = fSource.addOrCreateConf(fileConfs, configs, events, filePath)
 
 	fSource.Configurations = fileConfs
+	fSource.fileConfigs[filePath] = configs
 
 	return events
 }
@@ -541,7 +960,7 @@ func (fSource *Source) addOrCreateConf(fileConfs map[string]*ConfigInfo, newconf
 		}
 
 		if !handled {
-			events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
+			events = append(events, &event.Event{EventSource: fSource.GetSourceName(), Key: key,
 				EventType: event.Create, Value: value})
 			fileConfs[key] = &ConfigInfo{
 				FilePath: filePath,
@@ -554,15 +973,24 @@ func (fSource *Source) addOrCreateConf(fileConfs map[string]*ConfigInfo, newconf
 }
 
 // Cleanup clear all configs.
+// the watch is stopped first, so no file event changes the configs after they are cleared.
 func (fSource *Source) Cleanup() error {
-	fSource.filelock.Lock()
-	defer fSource.filelock.Unlock()
-
-	if fSource.watchPool != nil && fSource.watchPool.watcher != nil {
-		fSource.watchPool.watcher.Close()
+	fSource.Lock()
+	wth := fSource.watchPool
+	fSource.watchPool = nil
+	fSource.Unlock()
+	if wth != nil {
+		wth.stop()
 	}
 
+	fSource.Lock()
+	defer fSource.Unlock()
 	fSource.files = make([]file, 0)
+	fSource.includes = make(map[string][]string)
+	fSource.dirs = nil
+	fSource.fileConfigs = make(map[string]map[string]interface{})
+	fSource.missing = make(map[string]file)
+	fSource.links.Reset()
 	fSource.Configurations = make(map[string]*ConfigInfo, 0)
 	return nil
 }
@@ -24,11 +24,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/arielsrv/go-archaius/event"
 	filesource "github.com/arielsrv/go-archaius/source/file"
+	"github.com/arielsrv/go-archaius/source/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -138,3 +140,432 @@ others:
 		assert.Equal(t, nil, age)
 	})
 }
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("shared/db.yaml", "db:\n  host: 10.0.0.1\n  port: 3306\n")
+	write("shared/cache.json", `{"cache": {"size": 10}, "db": {"port": 3307}}`)
+	write("app.yaml", "$include:\n  - shared/db.yaml\n  - shared/*.json\ndb:\n  host: 10.0.0.2\nname: app\n")
+	write("cycle1.yaml", "$include: cycle2.yaml\n")
+	write("cycle2.yaml", "$include: cycle1.yaml\n")
+	write("missing.yaml", "$include: nothing.yaml\n")
+	write("plain.yaml", "include: true\nfeature:\n  include: somename\n")
+
+	fSource := filesource.NewFileSource()
+	h := new(TestDynamicConfigHandler)
+	assert.NoError(t, fSource.Watch(h))
+	assert.NoError(t, fSource.AddFile(filepath.Join(dir, "app.yaml"), 0, nil))
+	t.Run("included files are merged under the including file", func(t *testing.T) {
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"db.host":    "10.0.0.2",
+			"db.port":    3307,
+			"cache.size": 10,
+			"name":       "app",
+		}, configs)
+	})
+	t.Run("editing an included file reloads the including file", func(t *testing.T) {
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+		write("shared/cache.json", `{"cache": {"size": 20}}`)
+		assert.Eventually(t, func() bool {
+			port, _ := fSource.GetConfigurationByKey("db.port")
+			size, _ := fSource.GetConfigurationByKey("cache.size")
+			return port == 3306 && size == 20
+		}, 3*time.Second, 50*time.Millisecond)
+	})
+	t.Run("cycle", func(t *testing.T) {
+		err := fSource.AddFile(filepath.Join(dir, "cycle1.yaml"), 0, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "include cycle")
+	})
+	t.Run("missing include", func(t *testing.T) {
+		assert.Error(t, fSource.AddFile(filepath.Join(dir, "missing.yaml"), 0, nil))
+	})
+	t.Run("a plain include key is kept as a config", func(t *testing.T) {
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "plain.yaml"), 0, nil))
+		v, err := fSource.GetConfigurationByKey("include")
+		assert.NoError(t, err)
+		assert.Equal(t, true, v)
+		v, err = fSource.GetConfigurationByKey("feature.include")
+		assert.NoError(t, err)
+		assert.Equal(t, "somename", v)
+	})
+	assert.NoError(t, fSource.Cleanup())
+}
+
+type recordHandler struct {
+	mux    sync.Mutex
+	events []*event.Event
+}
+
+func (h *recordHandler) OnEvent(e *event.Event) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.events = append(h.events, e)
+}
+
+func (h *recordHandler) OnModuleEvent(_ []*event.Event) {}
+
+func (h *recordHandler) has(eventType, key string) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for _, e := range h.events {
+		if e.EventType == eventType && e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("conf.d/a.yaml", "a: 1\n")
+	write("conf.d/sub/b.yaml", "b: 2\n")
+	write("conf.d/sub/skip.yaml", "skip: 1\n")
+	write("conf.d/sub/c.json", `{"c": 3}`)
+	write("conf.d/readme.txt", "not a config")
+	write("conf.d/.hidden/d.yaml", "d: 4\n")
+
+	t.Run("one level", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "conf.d"), 0, nil))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1}, configs)
+	})
+	t.Run("recursive with exclude", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "conf.d"), 0, nil,
+			filesource.Recursive(), filesource.Exclude("skip.*")))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2, "c": 3}, configs)
+	})
+	t.Run("glob", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "conf.d/**/*.yaml"), 0, nil,
+			filesource.Exclude("sub/skip.yaml")))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, configs)
+	})
+	t.Run("files created, removed and renamed at runtime", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		h := new(recordHandler)
+		assert.NoError(t, fSource.Watch(h))
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "conf.d/**/*.yaml"), 0, nil))
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+		defer fSource.Cleanup()
+
+		write("conf.d/sub/new/e.yaml", "e: 5\n")
+		assert.Eventually(t, func() bool {
+			v, _ := fSource.GetConfigurationByKey("e")
+			return v == 5 && h.has(event.Create, "e")
+		}, 3*time.Second, 20*time.Millisecond)
+
+		assert.NoError(t, os.Remove(filepath.Join(dir, "conf.d/a.yaml")))
+		assert.Eventually(t, func() bool {
+			_, err := fSource.GetConfigurationByKey("a")
+			return err != nil && h.has(event.Delete, "a")
+		}, 3*time.Second, 20*time.Millisecond)
+
+		assert.NoError(t, os.Rename(filepath.Join(dir, "conf.d/sub/b.yaml"), filepath.Join(dir, "conf.d/sub/b.txt")))
+		assert.Eventually(t, func() bool {
+			_, err := fSource.GetConfigurationByKey("b")
+			return err != nil && h.has(event.Delete, "b")
+		}, 3*time.Second, 20*time.Millisecond)
+
+		assert.NoError(t, os.Rename(filepath.Join(dir, "conf.d/sub/b.txt"), filepath.Join(dir, "conf.d/sub/f.yaml")))
+		assert.Eventually(t, func() bool {
+			v, _ := fSource.GetConfigurationByKey("b")
+			return v == 2
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+}
+
+func TestDirectoryAddedAgain(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("a: 1\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.yaml"), []byte("b: 2\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(dir, 1, nil))
+	t.Run("the options of the later call apply", func(t *testing.T) {
+		assert.NoError(t, fSource.AddFile(dir, 0, nil, filesource.Recursive()))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, configs)
+		assert.Equal(t, map[string]uint32{
+			filepath.Join(dir, "a.yaml"):        0,
+			filepath.Join(dir, "sub", "b.yaml"): 0,
+		}, fSource.FilePriorities())
+	})
+	t.Run("the files not matching anymore are dropped", func(t *testing.T) {
+		assert.NoError(t, fSource.AddFile(dir, 0, nil, filesource.Exclude("a.yaml")))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{}, configs)
+		assert.Empty(t, fSource.FilePriorities())
+	})
+}
+
+func TestRemoveFile(t *testing.T) {
+	dir := t.TempDir()
+	high, low := filepath.Join(dir, "high.yaml"), filepath.Join(dir, "low.yaml")
+	assert.NoError(t, os.WriteFile(high, []byte("name: high\nonly: high\nport: 1\n"), 0600))
+	assert.NoError(t, os.WriteFile(low, []byte("name: low\nport: 2\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	h := new(recordHandler)
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	assert.NoError(t, fSource.AddFile(high, 0, nil))
+	assert.NoError(t, fSource.AddFile(low, 1, nil))
+	// let the file watcher start
+	time.Sleep(100 * time.Millisecond)
+	get := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+	assert.Equal(t, "high", get("name"))
+
+	t.Run("a key removed from a file falls back to another file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(high, []byte("name: high\nonly: high\n"), 0600))
+		assert.Eventually(t, func() bool {
+			return get("port") == 2 && h.has(event.Update, "port")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("removed file falls back to another file", func(t *testing.T) {
+		assert.NoError(t, os.Remove(high))
+		assert.Eventually(t, func() bool {
+			return get("name") == "low" && get("only") == nil && h.has(event.Delete, "only")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("removed file is added again when it comes back", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(high, []byte("name: back\n"), 0600))
+		assert.Eventually(t, func() bool {
+			return get("name") == "back"
+		}, 3*time.Second, 20*time.Millisecond)
+		assert.NoError(t, os.WriteFile(high, []byte("name: again\n"), 0600))
+		assert.Eventually(t, func() bool {
+			return get("name") == "again"
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("last file removed deletes the keys", func(t *testing.T) {
+		assert.NoError(t, os.Remove(low))
+		assert.Eventually(t, func() bool {
+			return get("port") == nil && h.has(event.Delete, "port")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+}
+
+// writeConfigMap writes the files like kubernetes does in a ConfigMap volume:
+// the files are links to ..data/name, and ..data is a link to a directory holding the files,
+// it is swapped atomically by a rename on update.
+func writeConfigMap(t *testing.T, dir, version string, files map[string]string) {
+	data := filepath.Join(dir, "..2024_"+version)
+	assert.NoError(t, os.MkdirAll(data, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(data, name), []byte(content), 0600))
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+	old, _ := os.Readlink(filepath.Join(dir, "..data"))
+	assert.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	if old != "" {
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, old)))
+	}
+}
+
+func TestAtomicReplace(t *testing.T) {
+	t.Run("write a temp file and rename it", func(t *testing.T) {
+		dir := t.TempDir()
+		f := filepath.Join(dir, "app.conf")
+		assert.NoError(t, os.WriteFile(f, []byte("v1"), 0600))
+		fSource := filesource.NewFileSource()
+		assert.NoError(t, fSource.Watch(new(recordHandler)))
+		defer fSource.Cleanup()
+		assert.NoError(t, fSource.AddFile(f, 0, util.UseFileNameAsKeyContentAsValue))
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+
+		for _, content := range []string{"v2", "v3"} {
+			tmp := filepath.Join(dir, ".app.conf.tmp")
+			assert.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+			assert.NoError(t, os.Rename(tmp, f))
+			assert.Eventually(t, func() bool {
+				v, _ := fSource.GetConfigurationByKey("app.conf")
+				return string(v.([]byte)) == content
+			}, 3*time.Second, 20*time.Millisecond)
+		}
+	})
+	t.Run("kubernetes ..data swap", func(t *testing.T) {
+		dir := t.TempDir()
+		writeConfigMap(t, dir, "1", map[string]string{"app.properties": "name=v1", "db.yaml": "db: v1"})
+		fSource := filesource.NewFileSource()
+		h := new(recordHandler)
+		assert.NoError(t, fSource.Watch(h))
+		defer fSource.Cleanup()
+		assert.NoError(t, fSource.AddFile(filepath.Join(dir, "app.properties"), 0, nil))
+		assert.NoError(t, fSource.AddFile(dir, 1, nil, filesource.Include("*.yaml")))
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"name": "v1", "db": "v1"}, configs)
+		// let the file watcher start
+		time.Sleep(100 * time.Millisecond)
+
+		for _, version := range []string{"2", "3"} {
+			writeConfigMap(t, dir, version, map[string]string{"app.properties": "name=v" + version, "db.yaml": "db: v" + version})
+			assert.Eventually(t, func() bool {
+				name, _ := fSource.GetConfigurationByKey("name")
+				db, _ := fSource.GetConfigurationByKey("db")
+				return name == "v"+version && db == "v"+version
+			}, 3*time.Second, 20*time.Millisecond)
+		}
+		assert.False(t, h.has(event.Delete, "name"))
+		assert.False(t, h.has(event.Delete, "db"))
+	})
+}
+
+func TestPolling(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "app.properties")
+	assert.NoError(t, os.WriteFile(f, []byte("name=aaa"), 0600))
+	fSource := filesource.NewFileSource(filesource.WithWatchMode(filesource.WatchPoll),
+		filesource.WithPollInterval(50*time.Millisecond))
+	h := new(recordHandler)
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	assert.NoError(t, fSource.AddFile(f, 0, nil))
+	assert.NoError(t, fSource.AddFile(dir, 1, nil, filesource.Include("*.yaml")))
+	// let the file watcher start
+	time.Sleep(100 * time.Millisecond)
+
+	t.Run("same size and modification time", func(t *testing.T) {
+		info, err := os.Stat(f)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(f, []byte("name=bbb"), 0600))
+		assert.NoError(t, os.Chtimes(f, info.ModTime(), info.ModTime()))
+		assert.Eventually(t, func() bool {
+			v, _ := fSource.GetConfigurationByKey("name")
+			return v == "bbb"
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("create a file in a directory", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("db: v1"), 0600))
+		assert.Eventually(t, func() bool {
+			v, _ := fSource.GetConfigurationByKey("db")
+			return v == "v1"
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+	t.Run("remove a file", func(t *testing.T) {
+		assert.NoError(t, os.Remove(filepath.Join(dir, "db.yaml")))
+		assert.Eventually(t, func() bool {
+			return h.has(event.Delete, "db")
+		}, 3*time.Second, 20*time.Millisecond)
+	})
+}
+
+func TestCleanupWhilePolling(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, os.WriteFile(f, []byte("name: v0\n"), 0600))
+	fSource := filesource.NewFileSource(filesource.WithWatchMode(filesource.WatchPoll),
+		filesource.WithPollInterval(10*time.Millisecond))
+	h := new(recordHandler)
+	assert.NoError(t, fSource.Watch(h))
+	assert.NoError(t, fSource.AddFile(dir, 0, nil))
+	// let the file watcher start
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, os.WriteFile(f, []byte(fmt.Sprintf("name: v%d\n", i)), 0600))
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.NoError(t, fSource.Cleanup())
+	assert.Empty(t, fSource.FilePriorities())
+
+	assert.NoError(t, os.WriteFile(f, []byte("name: after\n"), 0600))
+	time.Sleep(100 * time.Millisecond)
+	_, err := fSource.GetConfigurationByKey("name")
+	assert.Error(t, err)
+}
+
+func TestFilePriorities(t *testing.T) {
+	dir := t.TempDir()
+	f1, f2 := filepath.Join(dir, "f1.yaml"), filepath.Join(dir, "f2.yaml")
+	assert.NoError(t, os.WriteFile(f1, []byte("a: f1\nb: f1\n"), 0600))
+	assert.NoError(t, os.WriteFile(f2, []byte("b: f2\n"), 0600))
+	fSource := filesource.NewFileSource()
+	defer fSource.Cleanup()
+	assert.NoError(t, fSource.AddFile(f1, 1, nil))
+	assert.NoError(t, fSource.AddFile(f2, 0, nil))
+	assert.NoError(t, fSource.AddFile(f2, 0, nil))
+	assert.Equal(t, map[string]uint32{f1: 1, f2: 0}, fSource.FilePriorities())
+	b, err := fSource.GetConfigurationByKey("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "f2", b)
+}
+
+func TestLayer(t *testing.T) {
+	dir := t.TempDir()
+	app, prod, other := filepath.Join(dir, "app.yaml"), filepath.Join(dir, "app-prod.yaml"), filepath.Join(dir, "other.yaml")
+	assert.NoError(t, os.WriteFile(app, []byte("a: app\nb: app\n"), 0600))
+	assert.NoError(t, os.WriteFile(prod, []byte("a: prod\nb: prod\n"), 0600))
+	assert.NoError(t, os.WriteFile(other, []byte("b: other\n"), 0600))
+	fSource := filesource.NewFileSource()
+	defer fSource.Cleanup()
+	assert.NoError(t, fSource.AddFile(app, 1, nil, filesource.Layer(1)))
+	assert.NoError(t, fSource.AddFile(prod, 1, nil, filesource.Layer(0)))
+	assert.NoError(t, fSource.AddFile(other, 0, nil, filesource.Layer(1)))
+	// the layers do not change the priorities
+	assert.Equal(t, map[string]uint32{app: 1, prod: 1, other: 0}, fSource.FilePriorities())
+	assert.Equal(t, map[string]filesource.FileRank{
+		app:   {Priority: 1, Layer: 1},
+		prod:  {Priority: 1, Layer: 0},
+		other: {Priority: 0, Layer: 1},
+	}, fSource.FileRanks())
+	a, err := fSource.GetConfigurationByKey("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", a)
+	// the priority wins over the layer
+	b, err := fSource.GetConfigurationByKey("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", b)
+}
+
+func TestSourceName(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, os.WriteFile(f, []byte("a: v1\n"), 0600))
+	fSource := filesource.NewFileSource()
+	assert.Equal(t, filesource.FileConfigSourceConst, fSource.GetSourceName())
+	assert.Equal(t, filesource.FileSourcePriority, fSource.GetPriority())
+
+	fSource = filesource.NewFileSource(filesource.WithName("overrides"), filesource.WithPriority(0))
+	assert.Equal(t, "overrides", fSource.GetSourceName())
+	assert.Equal(t, 0, fSource.GetPriority())
+	h := new(recordHandler)
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	assert.NoError(t, fSource.AddFile(f, 0, nil))
+	assert.True(t, h.has(event.Create, "a"))
+	for _, e := range h.events {
+		assert.Equal(t, "overrides", e.EventSource)
+	}
+}
@@ -0,0 +1,164 @@
+package filesource
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/source/util"
+)
+
+// includeKey is the top level key of the include directive in yaml and json files,
+// the value is a path or a list of paths, relative to the including file, globs are allowed.
+// a plain include key is kept as a config.
+const includeKey = "$include"
+
+// includeExts are the extensions of the files supporting the include directive
+var includeExts = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// loadFile reads filePath with handle and merges the key values of the files it includes,
+// the key values of the including file override the included ones, and a later include overrides an earlier one.
+func (fSource *Source) loadFile(filePath string, handle util.FileHandler) (map[string]interface{}, error) {
+	included := make([]string, 0)
+	config, err := fSource.load(filePath, handle, nil, &included)
+	if err != nil {
+		return nil, err
+	}
+	fSource.setIncludes(filePath, included)
+	return config, nil
+}
+
+func (fSource *Source) load(filePath string, handle util.FileHandler, stack []string,
+	included *[]string) (map[string]interface{}, error) {
+	for _, p := range stack {
+		if p == filePath {
+			return nil, fmt.Errorf("include cycle %s", strings.Join(append(stack, filePath), " -> "))
+		}
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	config, err := handle(filePath, content)
+	if err != nil {
+		return nil, err
+	}
+	if !includeExts[strings.ToLower(filepath.Ext(filePath))] {
+		return config, nil
+	}
+	paths, err := includePaths(filePath, config)
+	if err != nil || len(paths) == 0 {
+		return config, err
+	}
+
+	merged := make(map[string]interface{})
+	for _, p := range paths {
+		*included = append(*included, p)
+		sub, err := fSource.load(p, fSource.fileHandler(p), append(stack, filePath), included)
+		if err != nil {
+			return nil, fmt.Errorf("failed to include [%s] in [%s], %s", p, filePath, err)
+		}
+		for k, v := range sub {
+			merged[k] = v
+		}
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// includePaths removes the include directive from config and returns the absolute paths of the included files,
+// a glob matching nothing includes nothing, and never matches the including file.
+func includePaths(filePath string, config map[string]interface{}) ([]string, error) {
+	var patterns []string
+	switch v := config[includeKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = append(patterns, v)
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("the %s of [%s] is not a list of paths", includeKey, filePath)
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, fmt.Errorf("the %s of [%s] is not a path", includeKey, filePath)
+	}
+	delete(config, includeKey)
+
+	paths := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filePath), pattern)
+		}
+		pattern = filepath.Clean(pattern)
+		if !strings.ContainsAny(pattern, "*?[") {
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, fmt.Errorf("[%s] file not exist", pattern)
+			}
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if m != filePath {
+				paths = append(paths, m)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// setIncludes records the files included by filePath, directly or not, and watches their directories.
+func (fSource *Source) setIncludes(filePath string, included []string) {
+	fSource.Lock()
+	if len(included) == 0 {
+		delete(fSource.includes, filePath)
+	} else {
+		fSource.includes[filePath] = included
+	}
+	fSource.Unlock()
+	if wth := fSource.watching(); wth != nil {
+		for _, p := range included {
+			wth.AddWatchFile(filepath.Dir(p))
+		}
+	}
+}
+
+// includedFiles returns all the files included by the source files
+func (fSource *Source) includedFiles() []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	files := make([]string, 0)
+	for _, included := range fSource.includes {
+		files = append(files, included...)
+	}
+	return files
+}
+
+// includingFiles returns the source files including filePath
+func (fSource *Source) includingFiles(filePath string) []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	files := make([]string, 0)
+	for including, included := range fSource.includes {
+		for _, p := range included {
+			if p == filePath {
+				files = append(files, including)
+				break
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
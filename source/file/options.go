@@ -0,0 +1,44 @@
+package filesource
+
+import "time"
+
+// Options hold the options of the file source.
+type Options struct {
+	// Name is the source name, FileConfigSourceConst by default, several file sources need different names
+	Name string
+	// Priority is the source priority among the other sources, the lower the higher the precedence
+	Priority     int
+	WatchMode    WatchMode
+	PollInterval time.Duration
+}
+
+// Option is a func.
+type Option func(options *Options)
+
+// WithName names the file source, so that several file sources can be added to the same manager.
+func WithName(name string) Option {
+	return func(options *Options) {
+		options.Name = name
+	}
+}
+
+// WithPriority sets the source priority, like 5 to be below the env source, or 1 to be above the cli source.
+func WithPriority(priority int) Option {
+	return func(options *Options) {
+		options.Priority = priority
+	}
+}
+
+// WithWatchMode decides how the file changes are watched, WatchAuto by default.
+func WithWatchMode(mode WatchMode) Option {
+	return func(options *Options) {
+		options.WatchMode = mode
+	}
+}
+
+// WithPollInterval sets the interval of polling, DefaultPollInterval by default.
+func WithPollInterval(interval time.Duration) Option {
+	return func(options *Options) {
+		options.PollInterval = interval
+	}
+}
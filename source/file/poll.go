@@ -0,0 +1,225 @@
+package filesource
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// WatchMode decides how the file source watches the file changes.
+type WatchMode string
+
+const (
+	// WatchAuto watches by fsnotify, and polls the files fsnotify can not watch, or all of them if it fails
+	// or reports an error.
+	WatchAuto WatchMode = "auto"
+	// WatchNotify watches by fsnotify only.
+	WatchNotify WatchMode = "notify"
+	// WatchPoll polls the files only, for NFS or the file systems fsnotify does not work on.
+	WatchPoll WatchMode = "poll"
+
+	// DefaultPollInterval is the interval of polling if none is given.
+	DefaultPollInterval = 2 * time.Second
+)
+
+// fileState is what the poller compares to find a changed file,
+// the hash is only computed for the files the source manages.
+type fileState struct {
+	dir     bool
+	modTime time.Time
+	size    int64
+	link    string
+	hash    [sha256.Size]byte
+}
+
+// poller watches the files by comparing their states at an interval,
+// and sends the changes as the events of fsnotify.
+type poller struct {
+	interval time.Duration
+	// hashed tells whether the content of a file is compared
+	hashed func(filePath string) bool
+
+	mux    sync.Mutex
+	paths  map[string]bool
+	states map[string]fileState
+
+	events chan fsnotify.Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newPoller(interval time.Duration, hashed func(string) bool) *poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &poller{
+		interval: interval,
+		hashed:   hashed,
+		paths:    make(map[string]bool),
+		states:   make(map[string]fileState),
+		events:   make(chan fsnotify.Event, 64),
+		done:     make(chan struct{}),
+	}
+}
+
+// add polls a file, or the entries of a directory.
+func (p *poller) add(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	states := p.scan(path)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.paths[path] = true
+	for k, v := range states {
+		if _, ok := p.states[k]; !ok {
+			p.states[k] = v
+		}
+	}
+	return nil
+}
+
+func (p *poller) start() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			close(p.events)
+			return
+		case <-ticker.C:
+			for _, e := range p.poll() {
+				select {
+				case p.events <- e:
+				case <-p.done:
+					close(p.events)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *poller) close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// poll scans the paths and returns the changes since the last poll.
+func (p *poller) poll() []fsnotify.Event {
+	p.mux.Lock()
+	paths := make([]string, 0, len(p.paths))
+	for path := range p.paths {
+		paths = append(paths, path)
+	}
+	p.mux.Unlock()
+
+	current := make(map[string]fileState)
+	for _, path := range paths {
+		for k, v := range p.scan(path) {
+			current[k] = v
+		}
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	events := make([]fsnotify.Event, 0)
+	for path, state := range current {
+		old, ok := p.states[path]
+		switch {
+		case !ok:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case old != state && !(old.dir && state.dir && old.link == state.link):
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path := range p.states {
+		if _, ok := current[path]; !ok {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+	p.states = current
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+	return events
+}
+
+// scan returns the state of path, and of its entries if it is a directory.
+func (p *poller) scan(path string) map[string]fileState {
+	states := make(map[string]fileState)
+	state, ok := p.stat(path)
+	if !ok {
+		return states
+	}
+	states[path] = state
+	if !state.dir {
+		return states
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		logrus.Debug(fmt.Sprintf("poll directory [%s] error %s", path, err))
+		return states
+	}
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
+		if s, ok := p.stat(entryPath); ok {
+			states[entryPath] = s
+		}
+	}
+	return states
+}
+
+func (p *poller) stat(path string) (fileState, bool) {
+	var state fileState
+	lInfo, err := os.Lstat(path)
+	if err != nil {
+		return state, false
+	}
+	if lInfo.Mode()&os.ModeSymlink != 0 {
+		state.link, _ = os.Readlink(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		// a dangling symlink
+		return state, true
+	}
+	if info.IsDir() {
+		state.dir = true
+		return state, true
+	}
+	state.modTime, state.size = info.ModTime(), info.Size()
+	if info.Mode().IsRegular() && p.hashed(path) {
+		if content, err := os.ReadFile(path); err == nil {
+			state.hash = sha256.Sum256(content)
+		}
+	}
+	return state, true
+}
+
+// tracked tells whether filePath is a file of the source, an included one or the one a file resolves to,
+// only their contents are hashed by the poller.
+// it holds the read lock of the source like the other readers of the files, so a poll never sees them half reset.
+func (fSource *Source) tracked(filePath string) bool {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	if fSource.links.Tracked(filePath) {
+		return true
+	}
+	for _, included := range fSource.includes {
+		for _, p := range included {
+			if p == filePath {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package filesource
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/arielsrv/go-archaius/source"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// SecretScheme is the scheme of the secret references to files, like ${file:/run/secrets/db_pass}.
+const SecretScheme = "file"
+
+func init() {
+	source.RegisterSecretResolver(SecretScheme, NewSecretResolver())
+}
+
+// SecretResolver reads secrets from files, like the secrets kubernetes mounts,
+// the content is cached and refreshed when the file changes,
+// then the keys referencing the file get update events.
+type SecretResolver struct {
+	mux     sync.Mutex
+	secrets map[string]string
+	refs    map[string][]string
+	watcher *fsnotify.Watcher
+	dirs    map[string]bool
+}
+
+// NewSecretResolver creates a SecretResolver, the file watcher starts with the first resolved secret.
+func NewSecretResolver() *SecretResolver {
+	return &SecretResolver{
+		secrets: make(map[string]string),
+		refs:    make(map[string][]string),
+		dirs:    make(map[string]bool),
+	}
+}
+
+// Resolve returns the content of the file ref without the trailing line break.
+func (r *SecretResolver) Resolve(ref string) (string, error) {
+	path, err := filepath.Abs(ref)
+	if err != nil {
+		return "", err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if v, ok := r.secrets[path]; ok {
+		return v, nil
+	}
+
+	v, err := readSecret(path)
+	if err != nil {
+		return "", err
+	}
+	r.secrets[path] = v
+	r.refs[path] = appendRef(r.refs[path], ref)
+	r.watchDir(filepath.Dir(path))
+	return v, nil
+}
+
+func readSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func appendRef(refs []string, ref string) []string {
+	for _, r := range refs {
+		if r == ref {
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
+
+// watchDir watches the directory of the secrets,
+// so a file replaced by rename or a kubernetes ..data symlink swap is noticed.
+func (r *SecretResolver) watchDir(dir string) {
+	if r.dirs[dir] {
+		return
+	}
+	if r.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			logrus.Error("new secret file watcher failed: " + err.Error())
+			return
+		}
+		r.watcher = watcher
+		go r.watch(watcher)
+	}
+	if err := r.watcher.Add(dir); err != nil {
+		logrus.Error(fmt.Sprintf("watch secret dir %s failed: %s", dir, err))
+		return
+	}
+	r.dirs[dir] = true
+}
+
+func (r *SecretResolver) watch(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			r.refresh(filepath.Dir(e.Name))
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.Debug(fmt.Sprintf("watch secret file error: %s", err))
+		}
+	}
+}
+
+// refresh reloads the cached secrets in dir, and notifies the changed ones.
+func (r *SecretResolver) refresh(dir string) {
+	var changed []string
+	r.mux.Lock()
+	for path, old := range r.secrets {
+		if filepath.Dir(path) != dir {
+			continue
+		}
+		v, err := readSecret(path)
+		if err != nil {
+			// it is resolved again when it is read next time
+			delete(r.secrets, path)
+			changed = append(changed, r.refs[path]...)
+			continue
+		}
+		if v != old {
+			r.secrets[path] = v
+			changed = append(changed, r.refs[path]...)
+		}
+	}
+	r.mux.Unlock()
+
+	for _, ref := range changed {
+		logrus.Info(fmt.Sprintf("secret file %s changed", ref))
+		source.NotifySecretChanged(SecretScheme, ref)
+	}
+}
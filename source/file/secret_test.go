@@ -0,0 +1,39 @@
+package filesource_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	filesource "github.com/arielsrv/go-archaius/source/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretResolver(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_pass")
+	err := os.WriteFile(secret, []byte("s3cret\n"), 0600)
+	assert.NoError(t, err)
+
+	r := filesource.NewSecretResolver()
+	v, err := r.Resolve(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+
+	t.Run("refresh after the file is replaced", func(t *testing.T) {
+		tmp := filepath.Join(dir, "db_pass.tmp")
+		err := os.WriteFile(tmp, []byte("n3w"), 0600)
+		assert.NoError(t, err)
+		err = os.Rename(tmp, secret)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			v, err := r.Resolve(secret)
+			return err == nil && v == "n3w"
+		}, 3*time.Second, 50*time.Millisecond)
+	})
+	t.Run("not existing file", func(t *testing.T) {
+		_, err := r.Resolve(filepath.Join(dir, "not_exist"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,31 @@
+package filesource
+
+// watchPath tracks the symlinks of filePath and watches its directories if the source is watched.
+func (fSource *Source) watchPath(filePath string) {
+	dirs := fSource.links.Track(filePath)
+	wth := fSource.watching()
+	if wth == nil {
+		return
+	}
+	for _, d := range dirs {
+		wth.AddWatchFile(d)
+	}
+}
+
+// watching returns the watch of the source, nil if the source is not watched.
+func (fSource *Source) watching() *watch {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	return fSource.watchPool
+}
+
+// filePaths returns the paths of the managed files.
+func (fSource *Source) filePaths() []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	paths := make([]string, 0, len(fSource.files))
+	for _, f := range fSource.files {
+		paths = append(paths, f.filePath)
+	}
+	return paths
+}
@@ -0,0 +1,185 @@
+package source
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"github.com/arielsrv/go-archaius/event"
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// Flatten converts obj into config key values, it is the reverse of Unmarshal,
+// the keys are made by the same tag rules and are prefixed with prefix.
+// nested structs and maps become dotted keys, slices become array values,
+// and the types Unmarshal decodes from a single value, like time.Duration, are written as string.
+func (m *Manager) Flatten(prefix string, obj interface{}, opts ...UnmarshalOption) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, ErrObjectInvalid
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map {
+		return nil, ErrObjectInvalid
+	}
+
+	d := newDecoder(m, opts...)
+	kvs := make(map[string]interface{})
+	if err := d.flatten(rv, d.decoderKey(prefix), kvs); err != nil {
+		return nil, err
+	}
+	if d.sep == event.DefaultSeparator && !m.opts.LowerCaseKeys {
+		return kvs, nil
+	}
+	converted := make(map[string]interface{}, len(kvs))
+	for k, v := range kvs {
+		converted[m.canonicalKey(d.managerKey(k))] = v
+	}
+	return converted, nil
+}
+
+// flatten puts the key values of rValue into kvs.
+func (d *decoder) flatten(rValue reflect.Value, key string, kvs map[string]interface{}) error {
+	for rValue.Kind() == reflect.Ptr || rValue.Kind() == reflect.Interface {
+		if rValue.IsNil() {
+			return nil
+		}
+		rValue = rValue.Elem()
+	}
+	if isDecodable(rValue.Type()) {
+		v, err := plainScalar(rValue)
+		if err != nil {
+			return fmt.Errorf("flatten %s: %w", key, err)
+		}
+		kvs[key] = v
+		return nil
+	}
+
+	switch rValue.Kind() {
+	case reflect.Struct:
+		structType := rValue.Type()
+		for i := 0; i < structType.NumField(); i++ {
+			structField := structType.Field(i)
+			if structField.PkgPath != "" {
+				continue
+			}
+			keyName := d.getKeyName(structField.Name, structField.Tag)
+			switch keyName {
+			case ignoreField:
+				continue
+			case inline:
+				keyName = doNotConsiderTag
+			}
+			if err := d.flatten(rValue.Field(i), getTagKey(key, keyName), kvs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range rValue.MapKeys() {
+			if err := d.flatten(rValue.MapIndex(k), getTagKey(key, fmt.Sprint(k.Interface())), kvs); err != nil {
+				return err
+			}
+		}
+	case reflect.Uintptr, reflect.Complex64, reflect.Complex128, reflect.Chan, reflect.Func,
+		reflect.UnsafePointer:
+		// ignore
+	default:
+		v, err := d.plainValue(rValue)
+		if err != nil {
+			return fmt.Errorf("flatten %s: %w", key, err)
+		}
+		kvs[key] = v
+	}
+	return nil
+}
+
+// plainValue converts rValue into the value types a config source holds,
+// structs and maps become map[string]interface{}, slices and arrays become []interface{}.
+func (d *decoder) plainValue(rValue reflect.Value) (interface{}, error) {
+	for rValue.Kind() == reflect.Ptr || rValue.Kind() == reflect.Interface {
+		if rValue.IsNil() {
+			return nil, nil
+		}
+		rValue = rValue.Elem()
+	}
+	if isDecodable(rValue.Type()) {
+		return plainScalar(rValue)
+	}
+
+	switch rValue.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		structType := rValue.Type()
+		for i := 0; i < structType.NumField(); i++ {
+			structField := structType.Field(i)
+			if structField.PkgPath != "" {
+				continue
+			}
+			keyName := d.getKeyName(structField.Name, structField.Tag)
+			if keyName == ignoreField {
+				continue
+			}
+			v, err := d.plainValue(rValue.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			if sub, ok := v.(map[string]interface{}); ok && keyName == inline {
+				for k, subV := range sub {
+					m[k] = subV
+				}
+				continue
+			}
+			m[keyName] = v
+		}
+		return m, nil
+	case reflect.Map:
+		m := make(map[string]interface{}, rValue.Len())
+		for _, k := range rValue.MapKeys() {
+			v, err := d.plainValue(rValue.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k.Interface())] = v
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if rValue.Kind() == reflect.Slice && rValue.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rValue.Bytes()), nil
+		}
+		arr := make([]interface{}, rValue.Len())
+		for i := range arr {
+			v, err := d.plainValue(rValue.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = v
+		}
+		return arr, nil
+	default:
+		return rValue.Interface(), nil
+	}
+}
+
+// plainScalar converts a value Unmarshal decodes from a single value back into that value,
+// by encoding.TextMarshaler or fmt.Stringer.
+func plainScalar(rValue reflect.Value) (interface{}, error) {
+	ptr := reflect.New(rValue.Type())
+	ptr.Elem().Set(rValue)
+	switch {
+	case ptr.Type().Implements(textMarshalerType):
+		b, err := ptr.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case ptr.Type().Implements(stringerType):
+		return ptr.Interface().(fmt.Stringer).String(), nil
+	}
+	return rValue.Interface(), nil
+}
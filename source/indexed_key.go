@@ -0,0 +1,129 @@
+package source
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/event"
+)
+
+// maxIndexVariants limits the indexes of a key which are tried in both forms.
+const maxIndexVariants = 3
+
+var indexReplacer = strings.NewReplacer("[", ".", "]", "")
+
+// normalizeIndexedKey converts a key like servers[0].host into servers.0.host.
+func normalizeIndexedKey(key string) string {
+	if !strings.Contains(key, "[") {
+		return key
+	}
+	return indexReplacer.Replace(key)
+}
+
+// normalizeIndexedKey converts a key like servers[0]/host into servers/0/host by the separator of keys.
+func (m *Manager) normalizeIndexedKey(key string) string {
+	sep := m.KeySeparator()
+	if sep == event.DefaultSeparator || !strings.Contains(key, "[") {
+		return normalizeIndexedKey(key)
+	}
+	return strings.NewReplacer("[", sep, "]", "").Replace(key)
+}
+
+func isIndex(part string) bool {
+	if part == "" {
+		return false
+	}
+	for _, c := range part {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// indexedKeyVariants returns the keys of parts in which each index is written as .N or [N],
+// the parts are joined by sep.
+func indexedKeyVariants(parts []string, sep string) []string {
+	variants := []string{""}
+	indexes := 0
+	for i, part := range parts {
+		next := make([]string, 0, len(variants)*2)
+		for _, v := range variants {
+			if i == 0 {
+				next = append(next, part)
+				continue
+			}
+			next = append(next, v+sep+part)
+			if isIndex(part) && indexes < maxIndexVariants {
+				next = append(next, v+"["+part+"]")
+			}
+		}
+		if i != 0 && isIndex(part) {
+			indexes++
+		}
+		variants = next
+	}
+	return variants
+}
+
+// getIndexedConfig resolves a key like servers.1.port or servers[1].port,
+// the element is looked up in the flattened keys first, then in the array value of its parent key.
+func (m *Manager) getIndexedConfig(key string) (interface{}, bool) {
+	sep := m.KeySeparator()
+	parts := strings.Split(m.normalizeIndexedKey(key), sep)
+	hasIndex := false
+	for _, part := range parts[1:] {
+		if isIndex(part) {
+			hasIndex = true
+			break
+		}
+	}
+	if !hasIndex {
+		return nil, false
+	}
+
+	if v, ok := m.loadIndexedConfig(parts); ok {
+		return v, true
+	}
+	for i := len(parts) - 1; i > 0; i-- {
+		if v, ok := m.loadIndexedConfig(parts[:i]); ok {
+			return lookupPath(v, parts[i:], sep)
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) loadIndexedConfig(parts []string) (interface{}, bool) {
+	for _, k := range indexedKeyVariants(parts, m.KeySeparator()) {
+		sourceName, ok := m.ConfigurationMap.Load(k)
+		if !ok {
+			continue
+		}
+		v := m.configValueBySource(k, sourceName.(string))
+		return v, v != nil
+	}
+	return nil, false
+}
+
+// lookupPath walks into arrays and maps of v by parts, the keys of maps are joined by sep.
+func lookupPath(v interface{}, parts []string, sep string) (interface{}, bool) {
+	if len(parts) == 0 {
+		return v, v != nil
+	}
+	switch t := v.(type) {
+	case []interface{}:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 || i >= len(t) {
+			return nil, false
+		}
+		return lookupPath(t[i], parts[1:], sep)
+	case map[string]interface{}:
+		// the maps in an array hold flattened keys
+		for j := len(parts); j > 0; j-- {
+			if e, ok := t[strings.Join(parts[:j], sep)]; ok {
+				return lookupPath(e, parts[j:], sep)
+			}
+		}
+	}
+	return nil, false
+}
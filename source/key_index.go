@@ -0,0 +1,104 @@
+package source
+
+import (
+	"path"
+	"strings"
+)
+
+// storeKey maps key to the source it is read from, and adds it to the key index.
+func (m *Manager) storeKey(key string, sourceName interface{}) {
+	if _, ok := m.ConfigurationMap.Load(key); !ok {
+		m.keyIndexMux.Lock()
+		m.keyIndex.AddPrefix(key)
+		m.keyIndexMux.Unlock()
+	}
+	m.ConfigurationMap.Store(key, sourceName)
+	m.indexReferences(key, sourceName)
+	m.warnDeprecated(key, sourceName)
+}
+
+// deleteKey removes key from the map of sources and the key index.
+func (m *Manager) deleteKey(key string) {
+	m.ConfigurationMap.Delete(key)
+	m.keyIndexMux.Lock()
+	m.keyIndex.RemovePrefix(key)
+	m.keyIndexMux.Unlock()
+	m.unindexReferences(key)
+}
+
+// KeysWithPrefix returns the sorted keys which are prefix or under it, like redis.addr for redis.
+func (m *Manager) KeysWithPrefix(prefix string) []string {
+	prefix = m.canonicalKey(prefix)
+	keys := make([]string, 0)
+	m.keyIndexMux.RLock()
+	defer m.keyIndexMux.RUnlock()
+	node := m.keyIndex.Find(prefix)
+	if node == nil {
+		return keys
+	}
+	node.Walk(func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Keys returns the sorted keys matching the glob pattern, like redis.* or *.timeout,
+// a pattern is matched by path.Match, so * also matches dots. an empty pattern matches all keys.
+// only the keys under the literal part of the pattern before the first dot followed by a wildcard are checked.
+func (m *Manager) Keys(pattern string) []string {
+	if pattern == "" {
+		return m.KeysWithPrefix("")
+	}
+	pattern = m.canonicalKey(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return []string{}
+	}
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	}
+	prefix := ""
+	if i := strings.LastIndex(literal, m.KeySeparator()); i >= 0 {
+		prefix = literal[:i]
+	} else if literal == pattern {
+		prefix = pattern
+	}
+
+	keys := make([]string, 0)
+	for _, key := range m.KeysWithPrefix(prefix) {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// GetByPrefix returns the key values under prefix, the keys are not changed.
+func (m *Manager) GetByPrefix(prefix string) map[string]interface{} {
+	configs := make(map[string]interface{})
+	for _, key := range m.KeysWithPrefix(prefix) {
+		if v := m.GetConfig(key); v != nil {
+			configs[key] = v
+		}
+	}
+	return configs
+}
+
+// GetTree returns the key values under prefix as nested maps,
+// for example {pool: {size: 10}} for prefix redis and key redis.pool.size.
+func (m *Manager) GetTree(prefix string) map[string]interface{} {
+	prefix = m.canonicalKey(prefix)
+	sep := m.KeySeparator()
+	relative := make(map[string]interface{})
+	for key, v := range m.GetByPrefix(prefix) {
+		if key == prefix {
+			continue
+		}
+		if prefix != "" {
+			key = key[len(prefix)+len(sep):]
+		}
+		relative[key] = v
+	}
+	return nestKeys(relative, sep)
+}
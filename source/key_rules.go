@@ -0,0 +1,177 @@
+package source
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/arielsrv/go-archaius/event"
+)
+
+// KeyNormalizer converts a key of a source into the key the manager uses,
+// for example APP_DB_HOST into app.db.host. it must return the same key for a converted key.
+type KeyNormalizer func(key string) string
+
+// ReplaceKeySeparator returns a KeyNormalizer which replaces old by sep in keys.
+func ReplaceKeySeparator(old, sep string) KeyNormalizer {
+	return func(key string) string {
+		return strings.ReplaceAll(key, old, sep)
+	}
+}
+
+// KeySeparator returns the separator of keys.
+func (m *Manager) KeySeparator() string {
+	if m.opts.KeySeparator == "" {
+		return event.DefaultSeparator
+	}
+	return m.opts.KeySeparator
+}
+
+// canonicalKey converts a key given to the manager by the key rules which apply to all sources.
+func (m *Manager) canonicalKey(key string) string {
+	if m.opts.LowerCaseKeys {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// keyNormalizer returns the KeyNormalizer of a source, nil if its keys are used as they are.
+func (m *Manager) keyNormalizer(sourceName string) KeyNormalizer {
+	n := m.opts.KeyNormalizers[sourceName]
+	if n == nil && m.KeySeparator() != event.DefaultSeparator {
+		n = ReplaceKeySeparator(event.DefaultSeparator, m.KeySeparator())
+	}
+	if !m.opts.LowerCaseKeys {
+		return n
+	}
+	if n == nil {
+		return strings.ToLower
+	}
+	return func(key string) string {
+		return strings.ToLower(n(key))
+	}
+}
+
+// normalizedSource converts the keys of a source by a KeyNormalizer,
+// and converts the keys back to read, set or delete them in the source.
+type normalizedSource struct {
+	ConfigSource
+	normalize KeyNormalizer
+
+	mux sync.RWMutex
+	// sourceKeys maps the converted keys to the keys of the source
+	sourceKeys map[string]string
+}
+
+func newNormalizedSource(s ConfigSource, n KeyNormalizer) *normalizedSource {
+	return &normalizedSource{ConfigSource: s, normalize: n, sourceKeys: make(map[string]string)}
+}
+
+// GetConfigurations gets all configurations of the source with the converted keys.
+func (s *normalizedSource) GetConfigurations() (map[string]interface{}, error) {
+	configs, err := s.ConfigSource.GetConfigurations()
+	if configs == nil {
+		return configs, err
+	}
+	normalized := make(map[string]interface{}, len(configs))
+	s.mux.Lock()
+	for k, v := range configs {
+		key := s.normalize(k)
+		normalized[key] = v
+		if key != k {
+			s.sourceKeys[key] = k
+		}
+	}
+	s.mux.Unlock()
+	return normalized, err
+}
+
+// GetConfigurationByKey gets the value of a converted key.
+func (s *normalizedSource) GetConfigurationByKey(key string) (interface{}, error) {
+	return s.ConfigSource.GetConfigurationByKey(s.sourceKey(key))
+}
+
+// Set sets the value of a converted key.
+func (s *normalizedSource) Set(key string, value interface{}) error {
+	return s.ConfigSource.Set(s.sourceKey(key), value)
+}
+
+// SetBatch sets the values of converted keys in one batch if the source supports it.
+func (s *normalizedSource) SetBatch(kvs map[string]interface{}) error {
+	bs, ok := s.ConfigSource.(BatchSetter)
+	if !ok {
+		for k, v := range kvs {
+			if err := s.Set(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	sourceKvs := make(map[string]interface{}, len(kvs))
+	for k, v := range kvs {
+		sourceKvs[s.sourceKey(k)] = v
+	}
+	return bs.SetBatch(sourceKvs)
+}
+
+// Delete deletes a converted key.
+func (s *normalizedSource) Delete(key string) error {
+	return s.ConfigSource.Delete(s.sourceKey(key))
+}
+
+// GetConfigurationOrigin tells where the value of a converted key comes from if the source can tell it.
+func (s *normalizedSource) GetConfigurationOrigin(key string) (string, error) {
+	og, ok := s.ConfigSource.(OriginGetter)
+	if !ok {
+		return "", nil
+	}
+	return og.GetConfigurationOrigin(s.sourceKey(key))
+}
+
+// Watch converts the keys of the events of the source before callback handles them.
+func (s *normalizedSource) Watch(callback EventHandler) error {
+	return s.ConfigSource.Watch(&normalizedHandler{source: s, callback: callback})
+}
+
+func (s *normalizedSource) sourceKey(key string) string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if k, ok := s.sourceKeys[key]; ok {
+		return k
+	}
+	return key
+}
+
+func (s *normalizedSource) normalizeEvent(e *event.Event) {
+	key := s.normalize(e.Key)
+	if key == e.Key {
+		return
+	}
+	s.mux.Lock()
+	if e.EventType == event.Delete {
+		delete(s.sourceKeys, key)
+	} else {
+		s.sourceKeys[key] = e.Key
+	}
+	s.mux.Unlock()
+	e.Key = key
+}
+
+// normalizedHandler converts the keys of events from a normalizedSource.
+type normalizedHandler struct {
+	source   *normalizedSource
+	callback EventHandler
+}
+
+// OnEvent converts the key of the event and passes it to the callback.
+func (h *normalizedHandler) OnEvent(e *event.Event) {
+	h.source.normalizeEvent(e)
+	h.callback.OnEvent(e)
+}
+
+// OnModuleEvent converts the keys of the events and passes them to the callback.
+func (h *normalizedHandler) OnModuleEvent(es []*event.Event) {
+	for _, e := range es {
+		h.source.normalizeEvent(e)
+	}
+	h.callback.OnModuleEvent(es)
+}
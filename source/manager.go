@@ -24,15 +24,14 @@ package source
 import (
 	"errors"
 	"fmt"
-	"io"
 	"reflect"
 	"regexp"
 	"sync"
 
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/redact"
 )
 
 // errors.
@@ -40,6 +39,7 @@ var (
 	ErrKeyNotExist   = errors.New("key does not exist")
 	ErrIgnoreChange  = errors.New("ignore key changed")
 	ErrWriterInvalid = errors.New("writer is invalid")
+	ErrObjectInvalid = errors.New("invalid object supplied")
 )
 
 // const.
@@ -57,18 +57,48 @@ type Manager struct {
 	ConfigurationMap sync.Map
 
 	dispatcher *event.Dispatcher
+
+	opts        Options
+	transformed sync.Map
+
+	keyIndexMux sync.RWMutex
+	keyIndex    event.PrefixIndex
+
+	aliasMux sync.RWMutex
+	// aliases maps the old keys to their new keys, aliasesOf maps the new keys to their old keys
+	aliases           map[string]alias
+	aliasesOf         map[string][]string
+	deprecationWarned sync.Map
+
+	refMux sync.RWMutex
+	// dependents maps a referenced key, and each key above it, to the keys referencing it,
+	// referencedBy maps a key to the keys it is indexed under in dependents
+	dependents   map[string]map[string]bool
+	referencedBy map[string][]string
+
+	// redactor holds the sensitive keys of the manager
+	redactor *redact.Registry
 }
 
 // NewManager creates an object of Manager.
-func NewManager() *Manager {
+func NewManager(opts ...Option) *Manager {
 	configMgr := new(Manager)
+	for _, opt := range opts {
+		opt(&configMgr.opts)
+	}
 	configMgr.dispatcher = event.NewDispatcher()
+	configMgr.dispatcher.SetSeparator(configMgr.KeySeparator())
+	configMgr.keyIndex.Separator = configMgr.KeySeparator()
 	configMgr.Sources = make(map[string]ConfigSource)
+	configMgr.redactor = redact.NewRegistry()
+	configMgr.redactor.AddPatterns(configMgr.opts.SensitiveKeys...)
+	configMgr.watchSecrets()
 	return configMgr
 }
 
 // Cleanup close and cleanup config manager channel.
 func (m *Manager) Cleanup() error {
+	m.unwatchSecrets()
 	// cleanup all dynamic handler
 	m.sourceMapMux.RLock()
 	defer m.sourceMapMux.RUnlock()
@@ -83,6 +113,7 @@ func (m *Manager) Cleanup() error {
 
 // Set call set of all sources.
 func (m *Manager) Set(k string, v interface{}) error {
+	k = m.canonicalKey(k)
 	m.sourceMapMux.RLock()
 	defer m.sourceMapMux.RUnlock()
 	var err error
@@ -95,8 +126,37 @@ func (m *Manager) Set(k string, v interface{}) error {
 	return nil
 }
 
+// SetBatch sets key values into all sources in one batch,
+// a source implementing BatchSetter fires one module event for the whole batch.
+func (m *Manager) SetBatch(kvs map[string]interface{}) error {
+	if m.opts.LowerCaseKeys {
+		canonical := make(map[string]interface{}, len(kvs))
+		for k, v := range kvs {
+			canonical[m.canonicalKey(k)] = v
+		}
+		kvs = canonical
+	}
+	m.sourceMapMux.RLock()
+	defer m.sourceMapMux.RUnlock()
+	for _, s := range m.Sources {
+		if bs, ok := s.(BatchSetter); ok {
+			if err := bs.SetBatch(kvs); err != nil {
+				return err
+			}
+			continue
+		}
+		for k, v := range kvs {
+			if err := s.Set(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Delete call Delete of all sources.
 func (m *Manager) Delete(k string) error {
+	k = m.canonicalKey(k)
 	m.sourceMapMux.RLock()
 	defer m.sourceMapMux.RUnlock()
 	var err error
@@ -118,7 +178,8 @@ func (m *Manager) Delete(k string) error {
 //  2. Based on type Unmarshal function will check and set the values
 //     ex: If type is basic types like int, string, float then it will assigb directly values,
 //     If type is map, ptr and struct then it will again send for unmarshal until it find the basic type and set the values
-func (m *Manager) Unmarshal(obj interface{}) error {
+//  3. In strict mode, Unmarshal returns a *StrictError if some keys are not consumed or some fields got no value.
+func (m *Manager) Unmarshal(obj interface{}, opts ...UnmarshalOption) error {
 	rv := reflect.ValueOf(obj)
 	// only pointers are accepted
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
@@ -127,29 +188,11 @@ func (m *Manager) Unmarshal(obj interface{}) error {
 		return err
 	}
 
-	return m.unmarshal(rv, doNotConsiderTag)
-}
-
-// Marshal function is used to write all configuration by yaml.
-func (m *Manager) Marshal(w io.Writer) error {
-	if w == nil {
-		logrus.Error("invalid writer")
-		return ErrWriterInvalid
-	}
-	allConfig := make(map[string]map[string]interface{})
-	for name, source := range m.Sources {
-		config, err := source.GetConfigurations()
-		if err != nil {
-			logrus.Error("get source " + name + " error " + err.Error())
-			continue
-		}
-		if len(config) == 0 {
-			continue
-		}
-		allConfig[name] = config
+	d := newDecoder(m, opts...)
+	if err := d.unmarshal(rv, d.decoderKey(m.canonicalKey(d.opts.Prefix))); err != nil {
+		return err
 	}
-	encode := yaml.NewEncoder(w)
-	return encode.Encode(allConfig)
+	return d.checkStrict()
 }
 
 // AddSource adds a source to configurationManager.
@@ -160,6 +203,9 @@ func (m *Manager) AddSource(source ConfigSource) error {
 		return err
 	}
 	sourceName := source.GetSourceName()
+	if n := m.keyNormalizer(sourceName); n != nil {
+		source = newNormalizedSource(source, n)
+	}
 	m.sourceMapMux.Lock()
 	_, ok := m.Sources[sourceName]
 	if ok {
@@ -210,23 +256,59 @@ func (m *Manager) pullSourceConfigs(source string) error {
 	return nil
 }
 
-// Configs returns all the key values.
+// Configs returns all the key values with their references resolved,
+// a key referencing a sensitive key keeps its references, so the sensitive value does not leak.
 func (m *Manager) Configs() map[string]interface{} {
 	config := make(map[string]interface{}, 0)
 
 	m.ConfigurationMap.Range(func(key, value interface{}) bool {
-		sValue := m.configValueBySource(key.(string), value.(string))
-		if sValue == nil {
-			return true
+		if rValue := m.exposedConfig(key.(string), value.(string)); rValue != nil {
+			config[key.(string)] = rValue
 		}
-		config[key.(string)] = sValue
 		return true
 	})
 
 	return config
 }
 
-// ConfigsWithSourceNames returns all the key values along with its source name
+// resolvedConfigs returns all the key values with their references resolved, the sensitive ones too.
+func (m *Manager) resolvedConfigs() map[string]interface{} {
+	config := make(map[string]interface{}, 0)
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		if rValue := m.resolvedConfig(key.(string), value.(string)); rValue != nil {
+			config[key.(string)] = rValue
+		}
+		return true
+	})
+	return config
+}
+
+// exposedConfig returns the value of key in the source sourceName with its references resolved,
+// unless they reach a sensitive key, then the references are kept so the sensitive value does not leak.
+func (m *Manager) exposedConfig(key, sourceName string) interface{} {
+	if m.referencesSensitive(key) {
+		return m.configValueBySource(key, sourceName)
+	}
+	return m.resolvedConfig(key, sourceName)
+}
+
+// resolvedConfig returns the value of key in the source sourceName with its references resolved,
+// the value is returned as it is if they can not be resolved.
+func (m *Manager) resolvedConfig(key, sourceName string) interface{} {
+	sValue := m.configValueBySource(key, sourceName)
+	if sValue == nil {
+		return nil
+	}
+	rValue, err := m.resolve(key, sValue, nil)
+	if err != nil {
+		logrus.Error(fmt.Sprintf("resolve references of %s failed: %s", key, err))
+		return sValue
+	}
+	return rValue
+}
+
+// ConfigsWithSourceNames returns all the key values along with its source name,
+// the values of sensitive keys are masked.
 // the returned map will be like:
 //
 //	map[string]interface{}{
@@ -240,8 +322,8 @@ func (m *Manager) ConfigsWithSourceNames() map[string]interface{} {
 		if sValue == nil {
 			return true
 		}
-		// each key stores its value and source name
-		config[key.(string)] = map[string]interface{}{"value": sValue, "source": value}
+		// each key stores its value and source name, the value of a sensitive key is masked
+		config[key.(string)] = map[string]interface{}{"value": m.redactor.Value(key.(string), sValue), "source": value}
 		return true
 	})
 	return config
@@ -285,12 +367,12 @@ func (m *Manager) configValueBySource(configKey, sourceName string) interface{}
 		nbSource := m.findNextBestSource(configKey, sourceName)
 		if nbSource != nil {
 			configValue, _ := nbSource.GetConfigurationByKey(configKey)
-			return configValue
+			return m.transform(configKey, configValue, nbSource.GetSourceName())
 		}
 		return nil
 	}
 
-	return configValue
+	return m.transform(configKey, configValue, sourceName)
 }
 
 func (m *Manager) addDimensionInfo(labels map[string]string) error {
@@ -307,18 +389,35 @@ func (m *Manager) addDimensionInfo(labels map[string]string) error {
 
 // IsKeyExist check if key exist in cache.
 func (m *Manager) IsKeyExist(key string) bool {
-	if _, ok := m.ConfigurationMap.Load(key); ok {
+	key = m.canonicalKey(key)
+	if _, ok := m.aliasedKey(key); ok {
 		return true
 	}
-
-	return false
+	_, ok := m.getIndexedConfig(key)
+	return ok
 }
 
 // GetConfig returns the value for a particular key from cache.
+// an indexed key like servers.1.port or servers[1].port is resolved into the array value of servers.
+// references to other keys like ${db.host} are resolved and the values written as ENC(cipher text) are decrypted,
+// if it fails the raw value is returned.
 func (m *Manager) GetConfig(key string) interface{} {
+	key = m.canonicalKey(key)
+	raw := m.getRawConfig(key)
+	value, err := m.revealConfig(key, raw)
+	if err != nil {
+		logrus.Error(err.Error())
+		return raw
+	}
+	return value
+}
+
+func (m *Manager) getRawConfig(key string) interface{} {
+	key, _ = m.aliasedKey(m.canonicalKey(key))
 	sourceName, ok := m.ConfigurationMap.Load(key)
 	if !ok {
-		return nil
+		v, _ := m.getIndexedConfig(key)
+		return v
 	}
 	return m.configValueBySource(key, sourceName.(string))
 }
@@ -327,7 +426,7 @@ func (m *Manager) updateConfigurationMap(source ConfigSource, configs map[string
 	for key := range configs {
 		sourceName, ok := m.ConfigurationMap.Load(key)
 		if !ok { // if key do not exist then add source
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
 			continue
 		}
 
@@ -335,13 +434,16 @@ func (m *Manager) updateConfigurationMap(source ConfigSource, configs map[string
 		currentSource, ok := m.Sources[sourceName.(string)]
 		m.sourceMapMux.RUnlock()
 		if !ok {
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
 			continue
 		}
 
 		currentSrcPriority := currentSource.GetPriority()
 		if currentSrcPriority > source.GetPriority() { // lesser value has high priority
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
+		} else if sourceName == source.GetSourceName() {
+			// the value may have changed
+			m.indexReferences(key, sourceName)
 		}
 	}
 
@@ -352,7 +454,7 @@ func (m *Manager) updateConfigurationMapByDI(source ConfigSource, configs map[st
 	for key := range configs {
 		sourceName, ok := m.ConfigurationMap.Load(key)
 		if !ok { // if key do not exist then add source
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
 			continue
 		}
 
@@ -360,13 +462,16 @@ func (m *Manager) updateConfigurationMapByDI(source ConfigSource, configs map[st
 		currentSource, ok := m.Sources[sourceName.(string)]
 		m.sourceMapMux.RUnlock()
 		if !ok {
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
 			continue
 		}
 
 		currentSrcPriority := currentSource.GetPriority()
 		if currentSrcPriority > source.GetPriority() { // lesser value has high priority
-			m.ConfigurationMap.Store(key, source.GetSourceName())
+			m.storeKey(key, source.GetSourceName())
+		} else if sourceName == source.GetSourceName() {
+			// the value may have changed
+			m.indexReferences(key, sourceName)
 		}
 	}
 
@@ -380,13 +485,19 @@ func (m *Manager) updateModuleEvent(es []*event.Event) error {
 
 	var validEvents []*event.Event
 	for i := 0; i < len(es); i++ {
+		// the value of an event handled by OnEvent before is transformed already
+		handled := es[i].HasUpdated
 		err := m.updateEvent(es[i])
 		if err != nil {
 			if err != ErrKeyNotExist {
-				logrus.Error(fmt.Sprintf("%dth event %+v got error:%v", i, *es[i], err))
+				logrus.Error(fmt.Sprintf("%dth event %s got error:%v", i, es[i], err))
 			}
 			continue
 		}
+		if !handled {
+			m.transformEvent(es[i])
+			m.resolveEvent(es[i])
+		}
 		validEvents = append(validEvents, es[i])
 	}
 
@@ -394,6 +505,9 @@ func (m *Manager) updateModuleEvent(es []*event.Event) error {
 		logrus.Info("all events are invalid")
 		return nil
 	}
+	validEvents = append(validEvents, m.aliasEvents(validEvents...)...)
+	validEvents = append(validEvents, m.dependentEvents(validEvents...)...)
+	m.markSensitiveEvents(validEvents...)
 
 	return m.dispatcher.DispatchModuleEvent(validEvents)
 }
@@ -403,8 +517,9 @@ func (m *Manager) updateEvent(e *event.Event) error {
 	if e == nil || e.EventSource == "" || e.Key == "" {
 		return errors.New("nil or invalid event supplied")
 	}
+	m.markSensitiveEvents(e)
 	if e.HasUpdated {
-		logrus.Debug(fmt.Sprintf("config update event %+v has been updated", *e))
+		logrus.Debug(fmt.Sprintf("config update event %s has been updated", e))
 		return nil
 	}
 	logrus.Info("config update event received")
@@ -412,9 +527,10 @@ func (m *Manager) updateEvent(e *event.Event) error {
 	case event.Create, event.Update:
 		sourceName, ok := m.ConfigurationMap.Load(e.Key)
 		if !ok {
-			m.ConfigurationMap.Store(e.Key, e.EventSource)
+			m.storeKey(e.Key, e.EventSource)
 			e.EventType = event.Create
 		} else if sourceName == e.EventSource {
+			m.indexReferences(e.Key, sourceName)
 			e.EventType = event.Update
 		} else if sourceName != e.EventSource {
 			prioritySrc := m.getHighPrioritySource(sourceName.(string), e.EventSource)
@@ -424,7 +540,7 @@ func (m *Manager) updateEvent(e *event.Event) error {
 					e.EventSource, sourceName))
 				return ErrIgnoreChange
 			}
-			m.ConfigurationMap.Store(e.Key, e.EventSource)
+			m.storeKey(e.Key, e.EventSource)
 			e.EventType = event.Update
 		}
 
@@ -439,9 +555,9 @@ func (m *Manager) updateEvent(e *event.Event) error {
 			// find less priority source or delete key
 			source := m.findNextBestSource(e.Key, sourceName.(string))
 			if source == nil {
-				m.ConfigurationMap.Delete(e.Key)
+				m.deleteKey(e.Key)
 			} else {
-				m.ConfigurationMap.Store(e.Key, source.GetSourceName())
+				m.storeKey(e.Key, source.GetSourceName())
 			}
 		}
 	}
@@ -460,7 +576,19 @@ func (m *Manager) OnEvent(event *event.Event) {
 		return
 	}
 
+	m.transformEvent(event)
+	m.resolveEvent(event)
 	m.dispatcher.DispatchEvent(event)
+	aliasEvents := m.aliasEvents(event)
+	m.markSensitiveEvents(aliasEvents...)
+	for _, e := range aliasEvents {
+		m.dispatcher.DispatchEvent(e)
+	}
+	dependentEvents := m.dependentEvents(append(aliasEvents, event)...)
+	m.markSensitiveEvents(dependentEvents...)
+	for _, e := range dependentEvents {
+		m.dispatcher.DispatchEvent(e)
+	}
 }
 
 // OnModuleEvent Triggers actions when events are generated.
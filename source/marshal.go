@@ -0,0 +1,238 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the output format of Marshal.
+type Format string
+
+// formats.
+const (
+	FormatYAML       Format = "yaml"
+	FormatJSON       Format = "json"
+	FormatTOML       Format = "toml"
+	FormatProperties Format = "properties"
+	FormatDotenv     Format = "dotenv"
+)
+
+// View decides which config Marshal writes.
+type View string
+
+// views.
+const (
+	// ViewPerSource writes the key values of each source under the source name.
+	ViewPerSource View = "per-source"
+	// ViewMerged writes the key values the application gets, the dotted keys are nested.
+	ViewMerged View = "merged"
+	// ViewWithProvenance writes the key values the application gets along with their source name.
+	ViewWithProvenance View = "with-provenance"
+)
+
+// ErrFormatInvalid is returned if the format of Marshal is unknown.
+var ErrFormatInvalid = errors.New("format is invalid")
+
+// MarshalOptions hold options of Marshal.
+type MarshalOptions struct {
+	Format Format
+	View   View
+}
+
+// MarshalOption is a func.
+type MarshalOption func(options *MarshalOptions)
+
+// WithFormat set the output format, default is yaml.
+func WithFormat(f Format) MarshalOption {
+	return func(options *MarshalOptions) {
+		options.Format = f
+	}
+}
+
+// WithView set the view of config, default is ViewPerSource.
+func WithView(v View) MarshalOption {
+	return func(options *MarshalOptions) {
+		options.View = v
+	}
+}
+
+// Marshal function is used to write all configuration, by yaml and grouped by source name by default.
+// the values of sensitive keys are masked.
+func (m *Manager) Marshal(w io.Writer, opts ...MarshalOption) error {
+	if w == nil {
+		logrus.Error("invalid writer")
+		return ErrWriterInvalid
+	}
+	o := MarshalOptions{Format: FormatYAML, View: ViewPerSource}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var sections []section
+	switch o.View {
+	case ViewPerSource:
+		sections = m.perSourceSections()
+	case ViewMerged:
+		sections = []section{{configs: m.redactor.Map(m.Configs())}}
+	case ViewWithProvenance:
+		sections = m.provenanceSections()
+	default:
+		return fmt.Errorf("view %s is invalid", o.View)
+	}
+
+	switch o.Format {
+	case FormatYAML:
+		return yaml.NewEncoder(w).Encode(document(sections, o.View, m.KeySeparator()))
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document(sections, o.View, m.KeySeparator()))
+	case FormatTOML:
+		return writeTOML(w, document(sections, o.View, m.KeySeparator()))
+	case FormatProperties:
+		return writeLines(w, sections, m.KeySeparator(), propertiesLine)
+	case FormatDotenv:
+		return writeLines(w, sections, m.KeySeparator(), dotenvLine)
+	}
+	return fmt.Errorf("%w: %s", ErrFormatInvalid, o.Format)
+}
+
+// section is a group of flat key values, written under its name.
+type section struct {
+	name    string
+	configs map[string]interface{}
+	// sources holds the source name of each key in the provenance view
+	sources map[string]string
+}
+
+func (m *Manager) perSourceSections() []section {
+	m.sourceMapMux.RLock()
+	defer m.sourceMapMux.RUnlock()
+	sections := make([]section, 0, len(m.Sources))
+	for name, source := range m.Sources {
+		config, err := source.GetConfigurations()
+		if err != nil {
+			logrus.Error("get source " + name + " error " + err.Error())
+			continue
+		}
+		if len(config) == 0 {
+			continue
+		}
+		sections = append(sections, section{name: name, configs: m.redactor.Map(config)})
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		return sections[i].name < sections[j].name
+	})
+	return sections
+}
+
+// provenanceSections returns the values of the merged view along with their source names,
+// the references are resolved like in the merged view, except those reaching a sensitive key.
+func (m *Manager) provenanceSections() []section {
+	s := section{configs: make(map[string]interface{}), sources: make(map[string]string)}
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		v := m.exposedConfig(key.(string), value.(string))
+		if v == nil {
+			return true
+		}
+		s.configs[key.(string)] = m.redactor.Value(key.(string), v)
+		s.sources[key.(string)] = value.(string)
+		return true
+	})
+	return []section{s}
+}
+
+// document converts the sections into the structure written by yaml, json and toml,
+// the merged keys are nested by sep.
+func document(sections []section, view View, sep string) map[string]interface{} {
+	switch view {
+	case ViewMerged:
+		return nestKeys(sections[0].configs, sep)
+	case ViewWithProvenance:
+		doc := make(map[string]interface{}, len(sections[0].configs))
+		for key, value := range sections[0].configs {
+			doc[key] = map[string]interface{}{"value": plainTree(value), "source": sections[0].sources[key]}
+		}
+		return doc
+	}
+	doc := make(map[string]interface{}, len(sections))
+	for _, s := range sections {
+		configs := make(map[string]interface{}, len(s.configs))
+		for key, value := range s.configs {
+			configs[key] = plainTree(value)
+		}
+		doc[s.name] = configs
+	}
+	return doc
+}
+
+// nestKeys rebuilds the hierarchy of keys separated by sep, like db.host into {db: {host: }},
+// a key which conflicts with a value of its parent key stays unsplit in the deepest map.
+func nestKeys(configs map[string]interface{}, sep string) map[string]interface{} {
+	root := make(map[string]interface{})
+	for _, key := range sortedKeys(configs) {
+		parts := strings.Split(key, sep)
+		current := root
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				current[part] = plainTree(configs[key])
+				break
+			}
+			child, ok := current[part]
+			if !ok {
+				next := make(map[string]interface{})
+				current[part] = next
+				current = next
+				continue
+			}
+			next, ok := child.(map[string]interface{})
+			if !ok {
+				current[strings.Join(parts[i:], sep)] = plainTree(configs[key])
+				break
+			}
+			current = next
+		}
+	}
+	return root
+}
+
+// plainTree converts the maps with interface keys decoded by yaml into maps with string keys.
+func plainTree(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = plainTree(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = plainTree(item)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = plainTree(item)
+		}
+		return arr
+	}
+	return value
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
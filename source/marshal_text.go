@@ -0,0 +1,170 @@
+package source
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+var envKeyReplacer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// writeLines writes the sections as key=value lines,
+// a section name or the source of a key is written as comment,
+// the elements of arrays and maps are written under the keys joined by sep.
+func writeLines(w io.Writer, sections []section, sep string, line func(key string, value interface{}) string) error {
+	bw := bufio.NewWriter(w)
+	for i, s := range sections {
+		if s.name != "" {
+			if i > 0 {
+				fmt.Fprintln(bw)
+			}
+			fmt.Fprintf(bw, "# %s\n", s.name)
+		}
+		flat := make(map[string]interface{}, len(s.configs))
+		for key, value := range s.configs {
+			flattenValue(key, value, sep, flat)
+		}
+		for _, key := range sortedKeys(flat) {
+			if source, ok := s.sources[key]; ok {
+				fmt.Fprintf(bw, "# source: %s\n", source)
+			} else if s.sources != nil {
+				// an element of an array value, its source is the one of the array
+				fmt.Fprintf(bw, "# source: %s\n", s.sources[arrayKey(key, sep, s.sources)])
+			}
+			fmt.Fprintln(bw, line(key, flat[key]))
+		}
+	}
+	return bw.Flush()
+}
+
+// flattenValue puts the elements of arrays and maps in value under the keys joined by sep, like db.host and tags.0.
+func flattenValue(key string, value interface{}, sep string, flat map[string]interface{}) {
+	switch v := plainTree(value).(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			flat[key] = ""
+		}
+		for k, item := range v {
+			flattenValue(key+sep+k, item, sep, flat)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			flat[key] = ""
+		}
+		for i, item := range v {
+			flattenValue(key+sep+strconv.Itoa(i), item, sep, flat)
+		}
+	default:
+		flat[key] = v
+	}
+}
+
+// arrayKey returns the key in sources which key is an element of.
+func arrayKey(key, sep string, sources map[string]string) string {
+	parts := strings.Split(key, sep)
+	for i := len(parts) - 1; i > 0; i-- {
+		k := strings.Join(parts[:i], sep)
+		if _, ok := sources[k]; ok {
+			return k
+		}
+	}
+	return key
+}
+
+func scalarString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// propertiesLine writes a line of java properties, the special characters are escaped.
+func propertiesLine(key string, value interface{}) string {
+	return escapeProperties(key, true) + "=" + escapeProperties(scalarString(value), false)
+}
+
+func escapeProperties(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '=', ':', '#', '!':
+			if isKey || i == 0 {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// dotenvLine writes a line of dotenv, the key is converted into an env variable name like DB_HOST.
+func dotenvLine(key string, value interface{}) string {
+	name := strings.ToUpper(envKeyReplacer.ReplaceAllString(key, "_"))
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	s := scalarString(value)
+	if s == "" || strings.ContainsAny(s, " \t\n\r\"'#$\\`=") {
+		s = strconv.Quote(s)
+		// variables are expanded in double quoted values
+		s = strings.ReplaceAll(s, "$", `\$`)
+	}
+	return name + "=" + s
+}
+
+// writeTOML writes doc as toml, the maps become tables and nil values are dropped since toml has no null.
+func writeTOML(w io.Writer, doc map[string]interface{}) error {
+	encoder := toml.NewEncoder(w)
+	encoder.Indent = ""
+	return encoder.Encode(dropNils(doc))
+}
+
+// dropNils returns a copy of value without the nil values in its maps and arrays.
+func dropNils(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if item != nil {
+				m[k] = dropNils(item)
+			}
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				arr = append(arr, dropNils(item))
+			}
+		}
+		return arr
+	}
+	return value
+}
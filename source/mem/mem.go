@@ -29,8 +29,9 @@ import (
 
 // const.
 const (
-	Name                         = "MemorySource"
-	memoryVariableSourcePriority = 1
+	Name = "MemorySource"
+	// Priority is the source priority of the memory source.
+	Priority = 1
 )
 
 var _ = errors.New("source is not ready")
@@ -48,7 +49,7 @@ type Source struct {
 // NewMemoryConfigurationSource initializes all necessary components for memory configuration.
 func NewMemoryConfigurationSource() source.ConfigSource {
 	memoryConfigSource := new(Source)
-	memoryConfigSource.priority = memoryVariableSourcePriority
+	memoryConfigSource.priority = Priority
 	memoryConfigSource.Configs = sync.Map{}
 	memoryConfigSource.Ready = make(chan bool)
 	return memoryConfigSource
@@ -137,6 +138,39 @@ func (ms *Source) Set(key string, value interface{}) error {
 	return nil
 }
 
+// SetBatch set mem configs, the module listeners get all changes in one event.
+func (ms *Source) SetBatch(kvs map[string]interface{}) error {
+	ms.waitOnce.Do(func() {
+		<-ms.Ready
+	})
+
+	events := make([]*event.Event, 0, len(kvs))
+	for key, value := range kvs {
+		e := new(event.Event)
+		e.EventSource = ms.GetSourceName()
+		e.Key = key
+		e.Value = value
+
+		if _, ok := ms.Configs.Load(key); !ok {
+			e.EventType = event.Create
+		} else {
+			e.EventType = event.Update
+		}
+
+		ms.Configs.Store(key, value)
+		events = append(events, e)
+	}
+
+	if ms.callback != nil && len(events) > 0 {
+		for _, e := range events {
+			ms.callback.OnEvent(e)
+		}
+		ms.callback.OnModuleEvent(events)
+	}
+
+	return nil
+}
+
 // Delete remvove mem config.
 func (ms *Source) Delete(key string) error {
 	ms.waitOnce.Do(func() {
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/source"
 	"github.com/arielsrv/go-archaius/source/mem"
 )
 
@@ -146,3 +147,51 @@ func TestMemoryConfigurationSource(t *testing.T) {
 		t.Error("memorysource cleanup is Failed")
 	}
 }
+
+type moduleEventHandler struct {
+	events      []*event.Event
+	moduleCalls int
+}
+
+func (h *moduleEventHandler) OnEvent(e *event.Event) {
+	h.events = append(h.events, e)
+}
+
+func (h *moduleEventHandler) OnModuleEvent(_ []*event.Event) {
+	h.moduleCalls++
+}
+
+func TestSetBatch(t *testing.T) {
+	memorysource := mem.NewMemoryConfigurationSource()
+	handler := new(moduleEventHandler)
+	go memorysource.Watch(handler)
+
+	err := memorysource.Set("db.host", "10.0.0.1")
+	if err != nil {
+		t.Error("Failed to Add Keyvalue pair memorysource")
+	}
+	handler.events, handler.moduleCalls = nil, 0
+
+	err = memorysource.(source.BatchSetter).SetBatch(map[string]interface{}{
+		"db.host": "10.0.0.2",
+		"db.port": 3306,
+	})
+	if err != nil {
+		t.Error("Failed to set batch to memorysource")
+	}
+	if handler.moduleCalls != 1 || len(handler.events) != 2 {
+		t.Errorf("expect 2 events in one module event, got %d events in %d", len(handler.events), handler.moduleCalls)
+	}
+	for _, e := range handler.events {
+		if e.Key == "db.host" && e.EventType != event.Update {
+			t.Error("Failed to get the update event")
+		}
+		if e.Key == "db.port" && e.EventType != event.Create {
+			t.Error("Failed to get the create event")
+		}
+	}
+	port, err := memorysource.GetConfigurationByKey("db.port")
+	if err != nil || port != 3306 {
+		t.Error("memorysource key value pairs is mismatched")
+	}
+}
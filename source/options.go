@@ -0,0 +1,81 @@
+package source
+
+import "github.com/arielsrv/go-archaius/pkg/cipher"
+
+// Options hold options of Manager.
+type Options struct {
+	// UnmarshalOptions are applied to every Unmarshal call before the options of the call
+	UnmarshalOptions []UnmarshalOption
+	// ValueTransformers run in order on every value before it is read or dispatched
+	ValueTransformers []ValueTransformer
+	// Cipher decrypts the values written as ENC(cipher text) when they are read
+	Cipher cipher.Cipher
+	// KeySeparator separates the parts of keys, event.DefaultSeparator if empty
+	KeySeparator string
+	// LowerCaseKeys lower cases all keys
+	LowerCaseKeys bool
+	// KeyNormalizers convert the keys of a source, by source name
+	KeyNormalizers map[string]KeyNormalizer
+	// SensitiveKeys are the glob patterns of the keys whose values are masked
+	SensitiveKeys []string
+}
+
+// Option is a func.
+type Option func(options *Options)
+
+// WithUnmarshalOptions set the default options of Unmarshal.
+func WithUnmarshalOptions(opts ...UnmarshalOption) Option {
+	return func(options *Options) {
+		options.UnmarshalOptions = append(options.UnmarshalOptions, opts...)
+	}
+}
+
+// WithValueTransformers appends transformers to the pipeline which runs on every value of all sources.
+func WithValueTransformers(transformers ...ValueTransformer) Option {
+	return func(options *Options) {
+		options.ValueTransformers = append(options.ValueTransformers, transformers...)
+	}
+}
+
+// WithCipher set the cipher which decrypts the values written as ENC(cipher text).
+func WithCipher(c cipher.Cipher) Option {
+	return func(options *Options) {
+		options.Cipher = c
+	}
+}
+
+// WithKeySeparator set the separator of keys, like / in db/host, it is . by default.
+// the keys of the sources are written with ., so . in them is replaced by the separator
+// unless a KeyNormalizer is set for the source.
+func WithKeySeparator(sep string) Option {
+	return func(options *Options) {
+		options.KeySeparator = sep
+	}
+}
+
+// WithLowerCaseKeys lower cases the keys of all sources and the keys given to the manager,
+// so DB.Host and db.host are the same key.
+func WithLowerCaseKeys() Option {
+	return func(options *Options) {
+		options.LowerCaseKeys = true
+	}
+}
+
+// WithSourceKeyNormalizer set the KeyNormalizer of the keys of a source,
+// it replaces the default one which only changes the separator.
+func WithSourceKeyNormalizer(sourceName string, n KeyNormalizer) Option {
+	return func(options *Options) {
+		if options.KeyNormalizers == nil {
+			options.KeyNormalizers = make(map[string]KeyNormalizer)
+		}
+		options.KeyNormalizers[sourceName] = n
+	}
+}
+
+// WithSensitiveKeys marks the keys matching the glob patterns as sensitive, like *password* or db.*.secret,
+// the patterns are matched ignoring case.
+func WithSensitiveKeys(patterns ...string) Option {
+	return func(options *Options) {
+		options.SensitiveKeys = append(options.SensitiveKeys, patterns...)
+	}
+}
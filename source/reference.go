@@ -0,0 +1,222 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// errors of references.
+var (
+	ErrReferenceCycle      = errors.New("config reference cycle")
+	ErrReferenceUnresolved = errors.New("config reference unresolved")
+)
+
+// referenceReg matches a reference to another key like ${db.host} or ${db/host},
+// env variables like ${NAME||default} are not matched.
+var referenceReg = regexp.MustCompile(`\$\{([a-zA-Z_][\w.\-\[\]/]*)\}`)
+
+// references returns the keys referenced by value.
+func references(value interface{}) []string {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "${") {
+		return nil
+	}
+	submatch := referenceReg.FindAllStringSubmatch(s, -1)
+	keys := make([]string, 0, len(submatch))
+	for _, sub := range submatch {
+		keys = append(keys, sub[1])
+	}
+	return keys
+}
+
+// GetConfigE returns the value of key with the references to other keys resolved and the encrypted values decrypted,
+// it returns an error if a reference is unresolved, references form a cycle or a value can not be decrypted.
+func (m *Manager) GetConfigE(key string) (interface{}, error) {
+	key = m.canonicalKey(key)
+	return m.revealConfig(key, m.getRawConfig(key))
+}
+
+func (m *Manager) revealConfig(key string, raw interface{}) (interface{}, error) {
+	value, err := m.resolve(key, raw, nil)
+	if err != nil {
+		return raw, fmt.Errorf("resolve references of %s failed: %w", key, err)
+	}
+	return m.reveal(key, value)
+}
+
+// resolve replaces the references in value of key by the values of the referenced keys,
+// a value which is a single reference keeps the type of the referenced value.
+func (m *Manager) resolve(key string, value interface{}, chain []string) (interface{}, error) {
+	return mapStrings(value, func(s string) (interface{}, error) {
+		return m.resolveString(key, s, chain)
+	})
+}
+
+func (m *Manager) resolveString(key, value string, chain []string) (interface{}, error) {
+	submatch := referenceReg.FindAllStringSubmatchIndex(value, -1)
+	if len(submatch) == 0 {
+		return value, nil
+	}
+	chain = append(chain, key)
+
+	var b strings.Builder
+	last := 0
+	for _, sub := range submatch {
+		ref := value[sub[2]:sub[3]]
+		refValue, err := m.resolveReference(ref, chain)
+		if err != nil {
+			return value, err
+		}
+		// a single reference keeps the type of the referenced value
+		if sub[0] == 0 && sub[1] == len(value) {
+			return refValue, nil
+		}
+		s, err := cast.ToStringE(refValue)
+		if err != nil {
+			return value, fmt.Errorf("%w: %s referenced by %s is not a scalar", ErrReferenceUnresolved, ref, key)
+		}
+		b.WriteString(value[last:sub[0]])
+		b.WriteString(s)
+		last = sub[1]
+	}
+	b.WriteString(value[last:])
+	return b.String(), nil
+}
+
+func (m *Manager) resolveReference(ref string, chain []string) (interface{}, error) {
+	for _, k := range chain {
+		if m.normalizeIndexedKey(k) == m.normalizeIndexedKey(m.canonicalKey(ref)) {
+			return nil, fmt.Errorf("%w: %s -> %s", ErrReferenceCycle, strings.Join(chain, " -> "), ref)
+		}
+	}
+	refValue := m.getRawConfig(ref)
+	if refValue == nil {
+		return nil, fmt.Errorf("%w: %s referenced by %s does not exist", ErrReferenceUnresolved, ref, chain[len(chain)-1])
+	}
+	return m.resolve(ref, refValue, chain)
+}
+
+// indexReferences records the keys referenced by the value of key in the source sourceName,
+// so that the keys referencing a changed key are found without reading all values.
+func (m *Manager) indexReferences(key string, sourceName interface{}) {
+	name, _ := sourceName.(string)
+	refs := references(m.configValueBySource(key, name))
+	m.refMux.Lock()
+	defer m.refMux.Unlock()
+	m.removeReferences(key)
+	if len(refs) == 0 {
+		return
+	}
+	if m.dependents == nil {
+		m.dependents = make(map[string]map[string]bool)
+		m.referencedBy = make(map[string][]string)
+	}
+	sep := m.KeySeparator()
+	indexed := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		// a change of a key above the reference, like a map value, changes the reference too
+		parts := strings.Split(m.normalizeIndexedKey(m.canonicalKey(ref)), sep)
+		for i := len(parts); i > 0; i-- {
+			k := strings.Join(parts[:i], sep)
+			if m.dependents[k] == nil {
+				m.dependents[k] = make(map[string]bool)
+			}
+			m.dependents[k][key] = true
+			indexed = append(indexed, k)
+		}
+	}
+	m.referencedBy[key] = indexed
+}
+
+// unindexReferences removes the references of a deleted key.
+func (m *Manager) unindexReferences(key string) {
+	m.refMux.Lock()
+	defer m.refMux.Unlock()
+	m.removeReferences(key)
+}
+
+// removeReferences must be called with refMux held.
+func (m *Manager) removeReferences(key string) {
+	for _, k := range m.referencedBy[key] {
+		delete(m.dependents[k], key)
+		if len(m.dependents[k]) == 0 {
+			delete(m.dependents, k)
+		}
+	}
+	delete(m.referencedBy, key)
+}
+
+// dependentEvents returns update events of the keys which reference the changed keys,
+// directly or through other keys.
+func (m *Manager) dependentEvents(es ...*event.Event) []*event.Event {
+	changed := make(map[string]bool, len(es))
+	queue := make([]string, 0, len(es))
+	for _, e := range es {
+		k := m.normalizeIndexedKey(e.Key)
+		if !changed[k] {
+			changed[k] = true
+			queue = append(queue, k)
+		}
+	}
+
+	var dependents []*event.Event
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		for _, key := range m.dependentsOf(k) {
+			if changed[m.normalizeIndexedKey(key)] {
+				continue
+			}
+			changed[m.normalizeIndexedKey(key)] = true
+			queue = append(queue, m.normalizeIndexedKey(key))
+			sourceName, ok := m.ConfigurationMap.Load(key)
+			if !ok {
+				continue
+			}
+			value, err := m.resolve(key, m.configValueBySource(key, sourceName.(string)), nil)
+			if err != nil {
+				logrus.Debug(fmt.Sprintf("resolve references of %s failed: %s", key, err))
+			}
+			dependents = append(dependents, &event.Event{
+				EventSource: sourceName.(string),
+				EventType:   event.Update,
+				Key:         key,
+				Value:       value,
+				HasUpdated:  true,
+			})
+		}
+	}
+	return dependents
+}
+
+// dependentsOf returns the sorted keys referencing key or a key under it.
+func (m *Manager) dependentsOf(key string) []string {
+	m.refMux.RLock()
+	defer m.refMux.RUnlock()
+	keys := make([]string, 0, len(m.dependents[key]))
+	for k := range m.dependents[key] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolveEvent replaces the value of a create or update event by its resolved value.
+func (m *Manager) resolveEvent(e *event.Event) {
+	if e.EventType == event.Delete || len(references(e.Value)) == 0 {
+		return
+	}
+	value, err := m.resolve(e.Key, e.Value, nil)
+	if err != nil {
+		logrus.Debug(fmt.Sprintf("resolve references of %s failed: %s", e.Key, err))
+		return
+	}
+	e.Value = value
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/arielsrv/go-archaius"
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/redact"
 	"github.com/arielsrv/go-archaius/source"
 	"github.com/arielsrv/go-archaius/source/remote"
 )
@@ -32,8 +33,9 @@ import (
 // const.
 const (
 	//ConfigCenterSourceName variable of type string.
-	ConfigCenterSourceName     = "ConfigCenterSource"
-	configCenterSourcePriority = 0
+	ConfigCenterSourceName = "ConfigCenterSource"
+	// ConfigCenterSourcePriority is the source priority of the config center.
+	ConfigCenterSourcePriority = 0
 )
 
 // Source handles configs from config center.
@@ -75,7 +77,7 @@ func NewConfigCenterSource(ci *archaius.RemoteInfo) (source.ConfigSource, error)
 	}
 	s := new(Source)
 	s.dimensions = []map[string]string{cc.Options().Labels}
-	s.priority = configCenterSourcePriority
+	s.priority = ConfigCenterSourcePriority
 	s.c = cc
 	s.RefreshMode = ci.RefreshMode
 	s.RefreshInterval = time.Second * time.Duration(ci.RefreshInterval)
@@ -126,7 +128,7 @@ func (rs *Source) refreshConfigurations() error {
 		return err
 	}
 	logrus.Debug("pull configs", logrus.WithFields(logrus.Fields{
-		"config": config,
+		"keys": redact.Keys(config),
 	}))
 	//Populate the events based on the changed value between current config and newly received Config
 	rs.Lock()
@@ -139,7 +141,7 @@ func (rs *Source) refreshConfigurations() error {
 	rs.currentConfig = config
 	//Generate OnEvent Callback based on the events created
 	if rs.eh != nil {
-		logrus.Debug(fmt.Sprintf("event on receive %v", events))
+		logrus.Debug(fmt.Sprintf("event on receive of keys %v", event.Keys(events)))
 		for _, e := range events {
 			rs.eh.OnEvent(e)
 		}
@@ -198,7 +200,7 @@ func (rs *Source) Watch(callback source.EventHandler) error {
 				return
 			}
 
-			logrus.Debug(fmt.Sprintf("event on receive %v", events))
+			logrus.Debug(fmt.Sprintf("event on receive of keys %v", event.Keys(events)))
 			for _, e := range events {
 				callback.OnEvent(e)
 			}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/arielsrv/go-archaius"
 	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/redact"
 	"github.com/arielsrv/go-archaius/source"
 	"github.com/arielsrv/go-archaius/source/remote"
 	"github.com/sirupsen/logrus"
@@ -32,8 +33,9 @@ import (
 // const.
 const (
 	//Name is the source name of kie.
-	Name              = "KieSource"
-	kieSourcePriority = 0
+	Name = "KieSource"
+	// Priority is the source priority of kie.
+	Priority = 0
 )
 
 // Source handles configs from ServiceComb-Kie.
@@ -72,7 +74,7 @@ func NewKieSource(ci *archaius.RemoteInfo) (source.ConfigSource, error) {
 	}
 	ks := new(Source)
 	ks.dimensions = []map[string]string{k.Options().Labels}
-	ks.priority = kieSourcePriority
+	ks.priority = Priority
 	ks.k = k
 	ks.RefreshMode = ci.RefreshMode
 	if ci.RefreshInterval == 0 {
@@ -127,7 +129,7 @@ func (ks *Source) refreshConfigurations() error {
 		return err
 	}
 	logrus.Debug("pull configs from kie", logrus.WithFields(logrus.Fields{
-		"config": config,
+		"keys": redact.Keys(config),
 	}))
 	return ks.updateConfigAndFireEvent(config)
 }
@@ -144,7 +146,7 @@ func (ks *Source) updateConfigAndFireEvent(config map[string]interface{}) error
 	ks.currentConfig = config
 	//Generate OnEvent Callback based on the events created
 	if ks.eh != nil {
-		logrus.Debug(fmt.Sprintf("received event %v", events))
+		logrus.Debug(fmt.Sprintf("received event of keys %v", event.Keys(events)))
 		for _, e := range events {
 			ks.eh.OnEvent(e)
 		}
@@ -199,7 +201,7 @@ func (ks *Source) Watch(callback source.EventHandler) error {
 	logrus.Info("start watching configurations")
 	err := ks.k.Watch(func(kv map[string]interface{}) {
 		logrus.Debug("watch configs", logrus.WithFields(logrus.Fields{
-			"config": kv,
+			"keys": redact.Keys(kv),
 		}))
 		err := ks.updateConfigAndFireEvent(kv)
 		if err != nil {
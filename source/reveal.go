@@ -0,0 +1,106 @@
+package source
+
+import (
+	"fmt"
+
+	"github.com/arielsrv/go-archaius/pkg/cipher"
+	"github.com/sirupsen/logrus"
+)
+
+// reveal resolves the secret references like ${file:/run/secrets/db_pass}
+// and decrypts the values written as ENC(cipher text) in value,
+// it is only called by the reads which give the value to the application,
+// so dumps of the config and events keep the references and the cipher text.
+func (m *Manager) reveal(key string, value interface{}) (interface{}, error) {
+	return mapStrings(value, func(s string) (interface{}, error) {
+		s, err := resolveSecrets(key, s)
+		if err != nil {
+			return s, err
+		}
+		if m.opts.Cipher == nil {
+			return s, nil
+		}
+		cipherText, ok := cipher.Unwrap(s)
+		if !ok {
+			return s, nil
+		}
+		plainText, err := m.opts.Cipher.Decrypt(cipherText)
+		if err != nil {
+			return s, fmt.Errorf("decrypt value of %s failed: %w", key, err)
+		}
+		return plainText, nil
+	})
+}
+
+// revealedConfigs returns all the key values with the secrets resolved and the encrypted values decrypted.
+func (m *Manager) revealedConfigs() map[string]interface{} {
+	configs := m.resolvedConfigs()
+	for k, v := range configs {
+		r, err := m.reveal(k, v)
+		if err != nil {
+			logrus.Error(err.Error())
+			continue
+		}
+		configs[k] = r
+	}
+	return configs
+}
+
+// mapStrings replaces the strings in value, including the ones in arrays and maps, by f,
+// value is not changed, a copy is returned if some strings are replaced.
+func mapStrings(value interface{}, f func(s string) (interface{}, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case []interface{}:
+		var mapped []interface{}
+		for i, item := range v {
+			r, err := mapStrings(item, f)
+			if err != nil {
+				return value, err
+			}
+			if mapped == nil && !isSameString(r, item) {
+				mapped = make([]interface{}, len(v))
+				copy(mapped, v)
+			}
+			if mapped != nil {
+				mapped[i] = r
+			}
+		}
+		if mapped == nil {
+			return value, nil
+		}
+		return mapped, nil
+	case map[string]interface{}:
+		var mapped map[string]interface{}
+		for k, item := range v {
+			r, err := mapStrings(item, f)
+			if err != nil {
+				return value, err
+			}
+			if mapped == nil && !isSameString(r, item) {
+				mapped = make(map[string]interface{}, len(v))
+				for mk, mv := range v {
+					mapped[mk] = mv
+				}
+			}
+			if mapped != nil {
+				mapped[k] = r
+			}
+		}
+		if mapped == nil {
+			return value, nil
+		}
+		return mapped, nil
+	}
+	return value, nil
+}
+
+func isSameString(a, b interface{}) bool {
+	as, ok := a.(string)
+	if !ok {
+		return false
+	}
+	bs, ok := b.(string)
+	return ok && as == bs
+}
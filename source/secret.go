@@ -0,0 +1,197 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSecretUnresolved is returned if a secret reference can not be resolved.
+var ErrSecretUnresolved = errors.New("secret reference unresolved")
+
+// secretReg matches a secret reference like ${file:/run/secrets/db_pass} or ${env:DB_PASS}.
+var secretReg = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9+.\-]*):([^}]+)\}`)
+
+// SecretResolver resolves the secret of a scheme,
+// for ${file:/run/secrets/db_pass} the resolver of scheme file gets ref /run/secrets/db_pass.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretResolverFunc is a func which implements SecretResolver.
+type SecretResolverFunc func(ref string) (string, error)
+
+// Resolve calls f.
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	secretMux       sync.RWMutex
+	secretResolvers = map[string]SecretResolver{
+		"env": SecretResolverFunc(resolveEnvSecret),
+	}
+	secretHandlers = map[*Manager]func(scheme, ref string){}
+	// notifyMux is held while the handlers run, so a manager is not cleaned up in the middle of one
+	notifyMux sync.RWMutex
+)
+
+// RegisterSecretResolver registers the resolver of scheme,
+// the registered resolver replaces the existing one of the same scheme.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretMux.Lock()
+	defer secretMux.Unlock()
+	secretResolvers[scheme] = r
+}
+
+// UnRegisterSecretResolver removes the resolver of scheme, the references of scheme are not resolved anymore.
+func UnRegisterSecretResolver(scheme string) {
+	secretMux.Lock()
+	defer secretMux.Unlock()
+	delete(secretResolvers, scheme)
+}
+
+func getSecretResolver(scheme string) (SecretResolver, bool) {
+	secretMux.RLock()
+	defer secretMux.RUnlock()
+	r, ok := secretResolvers[scheme]
+	return r, ok
+}
+
+// NotifySecretChanged tells the managers that the secret of scheme and ref is changed,
+// a resolver which caches secrets calls it after the cache is refreshed,
+// so the keys referencing the secret get update events.
+func NotifySecretChanged(scheme, ref string) {
+	notifyMux.RLock()
+	defer notifyMux.RUnlock()
+	secretMux.RLock()
+	handlers := make([]func(scheme, ref string), 0, len(secretHandlers))
+	for _, h := range secretHandlers {
+		handlers = append(handlers, h)
+	}
+	secretMux.RUnlock()
+	for _, h := range handlers {
+		h(scheme, ref)
+	}
+}
+
+func resolveEnvSecret(ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("env %s is not set", ref)
+	}
+	return v, nil
+}
+
+// ExecSecretResolver returns a resolver which runs the command in ref and returns its trimmed output,
+// for example ${exec:vault kv get -field=password secret/db}.
+// it is not registered by default, register it if the config is trusted:
+//
+//	source.RegisterSecretResolver("exec", source.ExecSecretResolver(5*time.Second))
+func ExecSecretResolver(timeout time.Duration) SecretResolver {
+	var cache sync.Map
+	return SecretResolverFunc(func(ref string) (string, error) {
+		if v, ok := cache.Load(ref); ok {
+			return v.(string), nil
+		}
+		args := strings.Fields(ref)
+		if len(args) == 0 {
+			return "", errors.New("empty command")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("run %s failed: %w", args[0], err)
+		}
+		v := strings.TrimSpace(string(out))
+		cache.Store(ref, v)
+		return v, nil
+	})
+}
+
+// resolveSecrets replaces the secret references in s by the secrets,
+// the references of schemes which have no resolver are kept.
+func resolveSecrets(key, s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	resolved := secretReg.ReplaceAllStringFunc(s, func(ref string) string {
+		sub := secretReg.FindStringSubmatch(ref)
+		r, ok := getSecretResolver(sub[1])
+		if !ok || err != nil {
+			return ref
+		}
+		v, rErr := r.Resolve(sub[2])
+		if rErr != nil {
+			err = fmt.Errorf("%w: %s of %s: %s", ErrSecretUnresolved, ref, key, rErr)
+			return ref
+		}
+		return v
+	})
+	if err != nil {
+		return s, err
+	}
+	return resolved, nil
+}
+
+// watchSecrets lets m fire update events of the keys referencing a changed secret.
+func (m *Manager) watchSecrets() {
+	secretMux.Lock()
+	defer secretMux.Unlock()
+	secretHandlers[m] = m.onSecretChanged
+}
+
+// unwatchSecrets stops the update events of changed secrets, and waits for the running handlers.
+func (m *Manager) unwatchSecrets() {
+	secretMux.Lock()
+	delete(secretHandlers, m)
+	secretMux.Unlock()
+	notifyMux.Lock()
+	defer notifyMux.Unlock()
+}
+
+func (m *Manager) onSecretChanged(scheme, ref string) {
+	var events []*event.Event
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		v := m.configValueBySource(key.(string), value.(string))
+		s, ok := v.(string)
+		if !ok || !strings.Contains(s, "${") {
+			return true
+		}
+		for _, sub := range secretReg.FindAllStringSubmatch(s, -1) {
+			if sub[1] == scheme && sub[2] == ref {
+				events = append(events, &event.Event{
+					EventSource: value.(string),
+					EventType:   event.Update,
+					Key:         key.(string),
+					Value:       v,
+					HasUpdated:  true,
+				})
+				break
+			}
+		}
+		return true
+	})
+	if len(events) == 0 {
+		return
+	}
+	events = append(events, m.dependentEvents(events...)...)
+	m.markSensitiveEvents(events...)
+	for _, e := range events {
+		m.dispatcher.DispatchEvent(e)
+	}
+	if err := m.dispatcher.DispatchModuleEvent(events); err != nil {
+		logrus.Error("dispatch events of changed secret failed: " + err.Error())
+	}
+}
@@ -0,0 +1,55 @@
+package source
+
+import (
+	"github.com/arielsrv/go-archaius/event"
+)
+
+// MarkSensitive marks the keys as sensitive, their values are masked in dumps, logs and the string form of events.
+// the keys are converted by the key rules of the manager first, so they match the keys the manager holds.
+func (m *Manager) MarkSensitive(keys ...string) {
+	for _, k := range keys {
+		m.redactor.MarkSensitive(m.canonicalKey(k))
+	}
+}
+
+// IsSensitive checks if the value of key is masked.
+func (m *Manager) IsSensitive(key string) bool {
+	return m.redactor.IsSensitive(m.canonicalKey(key))
+}
+
+// markSensitiveEvents marks the events of sensitive keys, and of the keys resolving a sensitive key,
+// before they are logged or dispatched.
+func (m *Manager) markSensitiveEvents(es ...*event.Event) {
+	for _, e := range es {
+		sensitive := m.redactor.IsSensitive(e.Key) || m.referencesSensitive(e.Key)
+		// a source may pass the same event to OnEvent and OnModuleEvent, and the first dispatch may still read it
+		if sensitive != e.Sensitive {
+			e.Sensitive = sensitive
+		}
+	}
+}
+
+// referencesSensitive tells whether the value of key references a sensitive key, directly or through other keys,
+// its resolved value holds the sensitive value then.
+func (m *Manager) referencesSensitive(key string) bool {
+	return m.reachesSensitive(m.getRawConfig(key), map[string]bool{m.canonicalKey(key): true})
+}
+
+func (m *Manager) reachesSensitive(value interface{}, seen map[string]bool) bool {
+	var refs []string
+	_, _ = mapStrings(value, func(s string) (interface{}, error) {
+		refs = append(refs, references(s)...)
+		return s, nil
+	})
+	for _, ref := range refs {
+		ref = m.canonicalKey(ref)
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		if m.redactor.IsSensitive(ref) || m.reachesSensitive(m.getRawConfig(ref), seen) {
+			return true
+		}
+	}
+	return false
+}
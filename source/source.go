@@ -17,6 +17,11 @@ type ConfigSource interface {
 	AddDimensionInfo(labels map[string]string) error
 }
 
+// BatchSetter is implemented by a source which can set many key values at once.
+type BatchSetter interface {
+	SetBatch(kvs map[string]interface{}) error
+}
+
 // EventHandler handles config change event.
 type EventHandler interface {
 	OnEvent(event *event.Event)
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/source/util"
+	"github.com/sirupsen/logrus"
+)
+
+// ValueTransformer converts the value of key which comes from the source named sourceName.
+type ValueTransformer func(key string, value interface{}, sourceName string) (interface{}, error)
+
+// transformedValue is a cached result of the transformers.
+type transformedValue struct {
+	sourceName string
+	raw        interface{}
+	value      interface{}
+}
+
+// ExpandEnv expands the env variables like ${NAME||default} in string values.
+func ExpandEnv(_ string, value interface{}, _ string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "${") {
+		return value, nil
+	}
+	return util.ExpandValueEnv(s), nil
+}
+
+// TrimSpace removes the leading and trailing white space of string values.
+func TrimSpace(_ string, value interface{}, _ string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// transform runs the transformers on the value of key in order,
+// the result is cached until the source or the raw value of key changes.
+func (m *Manager) transform(key string, value interface{}, sourceName string) interface{} {
+	if len(m.opts.ValueTransformers) == 0 || value == nil {
+		return value
+	}
+	if cached, ok := m.transformed.Load(key); ok {
+		tv := cached.(*transformedValue)
+		if tv.sourceName == sourceName && reflect.DeepEqual(tv.raw, value) {
+			return tv.value
+		}
+	}
+
+	result := value
+	for _, t := range m.opts.ValueTransformers {
+		v, err := t(key, result, sourceName)
+		if err != nil {
+			logrus.Error(fmt.Sprintf("transform value of %s from %s failed: %s", key, sourceName, err))
+			return value
+		}
+		result = v
+	}
+	m.transformed.Store(key, &transformedValue{sourceName: sourceName, raw: value, value: result})
+	return result
+}
+
+// transformEvent replaces the value of a create or update event by its transformed value.
+func (m *Manager) transformEvent(e *event.Event) {
+	if e.EventType == event.Delete {
+		m.transformed.Delete(e.Key)
+		return
+	}
+	e.Value = m.transform(e.Key, e.Value, e.EventSource)
+}
@@ -24,9 +24,12 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
+	"github.com/arielsrv/go-archaius/event"
 	"github.com/sirupsen/logrus"
 
 	"github.com/spf13/cast"
@@ -34,6 +37,7 @@ import (
 
 const (
 	configClientTag  = `yaml`
+	squash           = "squash"
 	ignoreField      = `ignoredField` // when used -
 	doNotConsiderTag = ``
 	inline           = "inline"
@@ -41,12 +45,258 @@ const (
 	fmtValueNotMatched = "value types of %s not matched. expect type : %s, config client type : %s"
 )
 
+// UnmarshalOptions hold options of Unmarshal.
+type UnmarshalOptions struct {
+	// Strict makes Unmarshal fail if a config key under a struct section is not consumed by any field,
+	// or if a struct field gets no value. the keys outside the sections, like the top-level keys
+	// a root struct does not model, are not reported.
+	Strict bool
+	// StrictIgnoredSources are the sources whose keys are not reported as unknown,
+	// like the env source holding all the env variables of the process.
+	StrictIgnoredSources []string
+	// TagNames is the fallback chain of struct tags to get the key of a field,
+	// the first tag which gives a name wins, default is yaml.
+	TagNames []string
+	// CaseInsensitive matches the keys ignoring case,
+	// and the field name is tried as key if no tag gives a name and no key matches its snake case.
+	CaseInsensitive bool
+	// Prefix is the key the object is unmarshalled from, default is the root of all keys.
+	Prefix string
+}
+
+// UnmarshalOption is a func.
+type UnmarshalOption func(options *UnmarshalOptions)
+
+// WithStrict enable strict unmarshalling,
+// the keys of ignoredSources are not reported as unknown.
+func WithStrict(ignoredSources ...string) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.Strict = true
+		options.StrictIgnoredSources = ignoredSources
+	}
+}
+
+// WithTagName set the struct tags used to get the key of a field,
+// the tags are tried in order, for example mapstructure, json, yaml.
+func WithTagName(tagNames ...string) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.TagNames = tagNames
+	}
+}
+
+// WithCaseInsensitive matches config keys and field names ignoring case.
+func WithCaseInsensitive() UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.CaseInsensitive = true
+	}
+}
+
+// WithPrefix unmarshal the keys under prefix, like redis for redis.addr and redis.timeout.
+func WithPrefix(prefix string) UnmarshalOption {
+	return func(options *UnmarshalOptions) {
+		options.Prefix = prefix
+	}
+}
+
+// StrictError is returned by a strict Unmarshal,
+// it lists the config keys no field consumed and the fields which got no value.
+type StrictError struct {
+	UnknownKeys []string
+	UnsetFields []string
+}
+
+// Error returns the error message.
+func (e *StrictError) Error() string {
+	msgs := make([]string, 0, 2)
+	if len(e.UnknownKeys) != 0 {
+		msgs = append(msgs, "unknown keys: "+strings.Join(e.UnknownKeys, ", "))
+	}
+	if len(e.UnsetFields) != 0 {
+		msgs = append(msgs, "unset fields: "+strings.Join(e.UnsetFields, ", "))
+	}
+	return "strict unmarshal failed, " + strings.Join(msgs, "; ")
+}
+
+// decoder holds the state of one Unmarshal call.
+type decoder struct {
+	m    *Manager
+	opts UnmarshalOptions
+	// sep is the separator of the keys of the manager, the decoder joins keys by . and converts them
+	sep string
+
+	// consumed records config keys which are assigned to a field
+	consumed map[string]bool
+	// sections records the prefixes of the nested structs
+	sections []string
+	// unset records the fields which got no value
+	unset []string
+	// foldedKeys maps the lower case keys to the keys, used if CaseInsensitive
+	foldedKeys map[string]string
+	// configKeys caches the keys of all configs
+	configKeys []string
+}
+
+func newDecoder(m *Manager, opts ...UnmarshalOption) *decoder {
+	d := &decoder{m: m, consumed: make(map[string]bool), sep: m.KeySeparator()}
+	for _, opt := range m.opts.UnmarshalOptions {
+		opt(&d.opts)
+	}
+	for _, opt := range opts {
+		opt(&d.opts)
+	}
+	if m.opts.LowerCaseKeys {
+		d.opts.CaseInsensitive = true
+	}
+	if len(d.opts.TagNames) == 0 {
+		d.opts.TagNames = []string{configClientTag}
+	}
+	return d
+}
+
+// managerKey converts a key joined by . into the key of the manager.
+func (d *decoder) managerKey(key string) string {
+	if d.sep == event.DefaultSeparator {
+		return key
+	}
+	return strings.ReplaceAll(key, event.DefaultSeparator, d.sep)
+}
+
+// decoderKey converts a key of the manager into the key joined by . .
+func (d *decoder) decoderKey(key string) string {
+	if d.sep == event.DefaultSeparator {
+		return key
+	}
+	return strings.ReplaceAll(key, d.sep, event.DefaultSeparator)
+}
+
+// configs returns all the revealed key values by the keys joined by . .
+func (d *decoder) configs() map[string]interface{} {
+	configs := d.m.revealedConfigs()
+	if d.sep == event.DefaultSeparator {
+		return configs
+	}
+	converted := make(map[string]interface{}, len(configs))
+	for k, v := range configs {
+		converted[d.decoderKey(k)] = v
+	}
+	return converted
+}
+
+// lookup returns the config key matching key and its value.
+func (d *decoder) lookup(key string) (string, interface{}) {
+	if v := d.m.GetConfig(d.managerKey(key)); v != nil || !d.opts.CaseInsensitive {
+		return key, v
+	}
+	if d.foldedKeys == nil {
+		d.foldedKeys = make(map[string]string)
+		for _, k := range d.keys() {
+			d.foldedKeys[strings.ToLower(normalizeIndexedKey(k))] = k
+		}
+	}
+	k, ok := d.foldedKeys[strings.ToLower(normalizeIndexedKey(key))]
+	if !ok {
+		return key, nil
+	}
+	return k, d.m.GetConfig(d.managerKey(k))
+}
+
+// keys returns the keys of all configs.
+func (d *decoder) keys() []string {
+	if d.configKeys == nil {
+		configs := d.m.Configs()
+		d.configKeys = make([]string, 0, len(configs))
+		for k := range configs {
+			d.configKeys = append(d.configKeys, d.decoderKey(k))
+		}
+	}
+	return d.configKeys
+}
+
+// fold returns the key used to compare keys.
+func (d *decoder) fold(key string) string {
+	if d.opts.CaseInsensitive {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// consume marks the key and all keys under it as consumed.
+func (d *decoder) consume(key string) {
+	if !d.opts.Strict {
+		return
+	}
+	d.consumed[d.fold(key)] = true
+}
+
+// markUnset records a field which got no value.
+func (d *decoder) markUnset(key string) {
+	if !d.opts.Strict {
+		return
+	}
+	d.unset = append(d.unset, key)
+}
+
+// checkStrict returns a *StrictError if some keys under the struct sections are not consumed,
+// or some fields got no value.
+func (d *decoder) checkStrict() error {
+	if !d.opts.Strict {
+		return nil
+	}
+	unknown := make([]string, 0)
+	for key := range d.m.Configs() {
+		folded := d.fold(d.decoderKey(key))
+		if d.isConsumed(folded) || d.ignored(key) {
+			continue
+		}
+		for _, section := range d.sections {
+			if strings.HasPrefix(folded, d.fold(section)+".") {
+				unknown = append(unknown, key)
+				break
+			}
+		}
+	}
+	if len(unknown) == 0 && len(d.unset) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	sort.Strings(d.unset)
+	return &StrictError{UnknownKeys: unknown, UnsetFields: d.unset}
+}
+
+// ignored tells whether key comes from one of the StrictIgnoredSources.
+func (d *decoder) ignored(key string) bool {
+	sourceName, ok := d.m.ConfigurationMap.Load(key)
+	if !ok {
+		return false
+	}
+	for _, name := range d.opts.StrictIgnoredSources {
+		if name == sourceName {
+			return true
+		}
+	}
+	return false
+}
+
+// isConsumed checks if the key or one of its parent keys is consumed.
+func (d *decoder) isConsumed(key string) bool {
+	for {
+		if d.consumed[key] {
+			return true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
 /*
 unmarshal configurations on supplied object.
 multi level configuration key structure > source.module.type.config: value
 simple key structure > config: value.
 */
-func (m *Manager) unmarshal(rValue reflect.Value, tagName string) (err error) {
+func (d *decoder) unmarshal(rValue reflect.Value, tagName string) (err error) {
 	// handle panic
 	defer func() {
 		if r := recover(); r != nil {
@@ -58,18 +308,18 @@ func (m *Manager) unmarshal(rValue reflect.Value, tagName string) (err error) {
 
 	switch rValue.Kind() {
 	case reflect.Ptr:
-		err := m.handlePtr(rValue, getTagKey(tagName, doNotConsiderTag))
+		err := d.handlePtr(rValue, getTagKey(tagName, doNotConsiderTag))
 		if err != nil {
 			return err
 		}
 
 	case reflect.Struct:
-		err := m.handleStruct(rValue, getTagKey(tagName, doNotConsiderTag))
+		err := d.handleStruct(rValue, getTagKey(tagName, doNotConsiderTag))
 		if err != nil {
 			return err
 		}
 	case reflect.Map:
-		err := m.handleMap(reflect.Value{}, rValue, getTagKey(tagName, doNotConsiderTag))
+		err := d.handleMap(reflect.Value{}, rValue, getTagKey(tagName, doNotConsiderTag))
 		if err != nil {
 			return err
 		}
@@ -77,7 +327,7 @@ func (m *Manager) unmarshal(rValue reflect.Value, tagName string) (err error) {
 		reflect.Float32, reflect.Float64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
 		reflect.Uint64, reflect.Bool, reflect.Interface, reflect.Array, reflect.Slice:
 		if rValue.CanSet() {
-			err := m.setValue(rValue, tagName)
+			err := d.setValue(rValue, tagName)
 			if err != nil {
 				return err
 			}
@@ -88,10 +338,10 @@ func (m *Manager) unmarshal(rValue reflect.Value, tagName string) (err error) {
 }
 
 // handle pointer type objects.
-func (m *Manager) handlePtr(rValue reflect.Value, tagName string) error {
+func (d *decoder) handlePtr(rValue reflect.Value, tagName string) error {
 	if rValue.IsNil() {
 		ptrValue := reflect.New(rValue.Type().Elem())
-		err := m.unmarshal(ptrValue, getTagKey(tagName, doNotConsiderTag))
+		err := d.unmarshal(ptrValue, getTagKey(tagName, doNotConsiderTag))
 		if err != nil {
 			return err
 		}
@@ -102,14 +352,14 @@ func (m *Manager) handlePtr(rValue reflect.Value, tagName string) error {
 		return nil
 	} else if rValue.Elem().Kind() == reflect.Ptr {
 		ptrValue := rValue.Elem()
-		err := m.handlePtr(ptrValue, getTagKey(tagName, doNotConsiderTag))
+		err := d.handlePtr(ptrValue, getTagKey(tagName, doNotConsiderTag))
 		if err != nil {
 			return err
 		}
 	}
 
 	ptrValue := rValue.Elem()
-	err := m.unmarshal(ptrValue, getTagKey(tagName, doNotConsiderTag))
+	err := d.unmarshal(ptrValue, getTagKey(tagName, doNotConsiderTag))
 	if err != nil {
 		return err
 	}
@@ -131,41 +381,71 @@ func getTagKey(currentTag, addTag string) string {
 }
 
 // handle struct type object.
-func (m *Manager) handleStruct(rValue reflect.Value, tagName string) error {
+func (d *decoder) handleStruct(rValue reflect.Value, tagName string) error {
 	structType := rValue.Type()
 	numOfField := structType.NumField()
+	if d.opts.Strict && tagName != doNotConsiderTag {
+		d.sections = append(d.sections, tagName)
+	}
 
 	for i := 0; i < numOfField; i++ {
 		structField := structType.Field(i)
 		fieldValue := rValue.Field(i)
-		keyName := m.getKeyName(structField.Name, structField.Tag)
+		if structField.PkgPath != "" {
+			// unexported fields can not be set
+			continue
+		}
+		keyName := d.fieldKeyName(tagName, structField)
 		if keyName == ignoreField {
-			return nil
+			// only this field is ignored, not the ones after it
+			continue
+		}
+
+		// types like time.Time and *url.URL are converted from a single value, their fields are not keys
+		if _, v := d.lookup(getTagKey(tagName, keyName)); v != nil && isDecodable(structField.Type) {
+			if fieldValue.CanSet() {
+				if err := d.setValue(fieldValue, getTagKey(tagName, keyName)); err != nil {
+					return err
+				}
+			}
+			continue
+		} else if isLeafStruct(structField.Type) {
+			d.markUnset(getTagKey(tagName, keyName))
+			if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() && fieldValue.CanSet() {
+				fieldValue.Set(reflect.New(structField.Type.Elem()))
+			}
+			continue
 		}
 
 		switch structField.Type.Kind() {
 		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Float32, reflect.Float64, reflect.Uint, reflect.Uint8, reflect.Uint16,
-			reflect.Uint32, reflect.Uint64, reflect.Bool, reflect.Interface, reflect.Array,
-			reflect.Slice:
+			reflect.Uint32, reflect.Uint64, reflect.Bool, reflect.Interface, reflect.Array:
 			if fieldValue.CanSet() {
-				err := m.setValue(fieldValue, getTagKey(tagName, keyName))
+				err := d.setValue(fieldValue, getTagKey(tagName, keyName))
+				if err != nil {
+					return err
+				}
+			}
+		case reflect.Slice:
+			if fieldValue.CanSet() {
+				err := d.handleSlice(fieldValue, getTagKey(tagName, keyName))
 				if err != nil {
 					return err
 				}
 			}
 		case reflect.Ptr:
-			err := m.handlePtr(fieldValue, getTagKey(tagName, keyName))
+			err := d.handlePtr(fieldValue, getTagKey(tagName, keyName))
 			if err != nil {
 				return err
 			}
 		case reflect.Struct:
-			err := m.handleStruct(fieldValue, getTagKey(tagName, keyName))
+			err := d.handleStruct(fieldValue, getTagKey(tagName, keyName))
 			if err != nil {
 				return err
 			}
 		case reflect.Map:
-			err := m.handleMap(rValue, fieldValue, getTagKey(tagName, keyName))
+			err := d.handleMap(rValue, fieldValue, getTagKey(tagName, keyName))
 			if err != nil {
 				return err
 			}
@@ -178,14 +458,88 @@ func (m *Manager) handleStruct(rValue reflect.Value, tagName string) error {
 	return nil
 }
 
+// takesValue tells whether a single value can be converted into t, unlike a struct or a map made of keys.
+func takesValue(t reflect.Type) bool {
+	if isDecodable(t) {
+		return true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct && t.Kind() != reflect.Map
+}
+
+// isLeafStruct tells whether t is a struct, or a pointer to it, converted from a single value like time.Time,
+// a leaf struct without value is unset, its fields are not keys.
+func isLeafStruct(t reflect.Type) bool {
+	if !isDecodable(t) {
+		return false
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// handle slice, the elements come from the array value of the key,
+// and the indexed keys like key.0.name or key[0].name override them.
+func (d *decoder) handleSlice(rValue reflect.Value, tagName string) error {
+	length := d.indexedLen(tagName)
+	if length == 0 || isDecodable(rValue.Type()) {
+		return d.setValue(rValue, tagName)
+	}
+
+	configKey, configValue := d.lookup(tagName)
+	if arr, ok := configValue.([]interface{}); ok {
+		d.consume(configKey)
+		if len(arr) > length {
+			length = len(arr)
+		}
+	}
+
+	sliceValue := reflect.MakeSlice(rValue.Type(), length, length)
+	for i := 0; i < length; i++ {
+		err := d.unmarshal(sliceValue.Index(i), getTagKey(tagName, strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+	}
+	rValue.Set(sliceValue)
+
+	return nil
+}
+
+// indexedLen returns the length of the slice given by the indexed keys under the key.
+func (d *decoder) indexedLen(key string) int {
+	prefix := d.fold(key) + "."
+	length := 0
+	for _, k := range d.keys() {
+		k = d.fold(normalizeIndexedKey(k))
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		index := strings.SplitN(k[len(prefix):], ".", 2)[0]
+		if !isIndex(index) {
+			continue
+		}
+		if i, err := strconv.Atoi(index); err == nil && i >= length {
+			length = i + 1
+		}
+	}
+	return length
+}
+
 // handle map.
-func (m *Manager) handleMap(rValueForInline, rValue reflect.Value, tagName string) error {
+func (d *decoder) handleMap(rValueForInline, rValue reflect.Value, tagName string) error {
 	if tagName == doNotConsiderTag {
 		if rValue.CanSet() {
-			configValue := m.Configs()
+			configValue := d.m.revealedConfigs()
 			if configValue == nil {
 				return nil
 			}
+			for key := range configValue {
+				d.consume(d.decoderKey(key))
+			}
 			configRValue := reflect.ValueOf(configValue)
 			rValue.Set(configRValue)
 		}
@@ -199,10 +553,13 @@ func (m *Manager) handleMap(rValueForInline, rValue reflect.Value, tagName strin
 		return errors.New("map key should be string")
 	}
 
-	mapValue, err := m.populateMap(tagName, mapType, rValueForInline)
+	mapValue, err := d.populateMap(tagName, mapType, rValueForInline)
 	if err != nil {
 		return err
 	}
+	if mapValue.Len() == 0 && !strings.Contains(tagName, inline) {
+		d.markUnset(tagName)
+	}
 
 	// if assignable then only assign
 	if mapValue.Type() != mapType {
@@ -217,14 +574,14 @@ func (m *Manager) handleMap(rValueForInline, rValue reflect.Value, tagName strin
 	return nil
 }
 
-func (m *Manager) getTagList(prefix string, rValues reflect.Value) []string {
+func (d *decoder) getTagList(prefix string, rValues reflect.Value) []string {
 	var tagList []string
 
 	if strings.Contains(prefix, inline) {
 		for i := 0; i < rValues.Type().NumField(); i++ {
 			structField := rValues.Type().Field(i)
-			if structField.Tag != `yaml:",inline"` {
-				keyName := m.getKeyName(structField.Name, structField.Tag)
+			keyName := d.getKeyName(structField.Name, structField.Tag)
+			if keyName != inline {
 				tagList = append(tagList, keyName)
 			}
 		}
@@ -233,61 +590,26 @@ func (m *Manager) getTagList(prefix string, rValues reflect.Value) []string {
 	return tagList
 }
 
-func (m *Manager) getMapKeys(configValue map[string]interface{}, prefix string, tagList []string) ([]string,
-	[]string, []string) {
-	var (
-		mapKeys, prefixForInline, inlineVal []string
-	)
-
-	if strings.Contains(prefix, inline) {
-		pfx, iVal := checkPrefixForInline(prefix, tagList, configValue)
-
-		if len(iVal) != 0 {
-			inlineVal = iVal
+// getMapKeys returns the keys under prefix with prefix trimmed, each starting with a dot.
+func (d *decoder) getMapKeys(configValue map[string]interface{}, prefix string) []string {
+	var mapKeys []string
+	for key := range configValue {
+		isPrefix, index := checkPrefix(key, prefix+".")
+		if !isPrefix && d.opts.CaseInsensitive {
+			isPrefix, index = checkPrefix(strings.ToLower(key), strings.ToLower(prefix+"."))
 		}
-
-		if len(pfx) != 0 {
-			prefixForInline = pfx
+		if !isPrefix || len(prefix) == 0 {
+			continue
 		}
-	} else {
-		for key := range configValue {
-			isPrefix, index := checkPrefix(key, prefix+".")
-			if !isPrefix || len(prefix) == 0 {
-				continue
-			}
-
-			mapKeys = append(mapKeys, key[index-1:])
-		}
-	}
-
-	return prefixForInline, inlineVal, mapKeys
-}
 
-func (m *Manager) setValuesForInline(mapValueType reflect.Type, inlineVal, prefixForInline []string, rValue reflect.Value) (reflect.Value, error) {
-	mapValue := reflect.New(mapValueType)
-	if len(inlineVal) != 0 {
-		for _, iValues := range inlineVal {
-			mapKey := iValues
-			for _, pfx := range prefixForInline {
-				if isSliceContainString(mapKey, strings.Split(pfx, ".")) {
-					err := m.unmarshal(mapValue, getTagKey(pfx, doNotConsiderTag))
-					if err != nil {
-						return rValue, err
-					}
-					if rValue.CanSet() {
-						rValue.SetMapIndex(reflect.ValueOf(mapKey), mapValue.Elem())
-					}
-				}
-			}
-		}
+		mapKeys = append(mapKeys, key[index-1:])
 	}
-
-	return rValue, nil
+	return mapKeys
 }
 
 // generate map from config map.
-func (m *Manager) populateMap(prefix string, mapType reflect.Type, rValues reflect.Value) (reflect.Value, error) {
-	tagList := m.getTagList(prefix, rValues)
+func (d *decoder) populateMap(prefix string, mapType reflect.Type, rValues reflect.Value) (reflect.Value, error) {
+	tagList := d.getTagList(prefix, rValues)
 
 	rValuePtr := reflect.New(mapType)
 	rValue := rValuePtr.Elem()
@@ -295,17 +617,18 @@ func (m *Manager) populateMap(prefix string, mapType reflect.Type, rValues refle
 	//rValue := reflect.MakeMap(mapType)
 	mapValueType := rValue.Type().Elem()
 
-	configValue := m.Configs()
-
-	prefixForInline, inlineVal, mapKeys := m.getMapKeys(configValue, prefix, tagList)
+	configValue := d.configs()
 
 	if strings.Contains(prefix, inline) {
-		return m.setValuesForInline(mapValueType, inlineVal, prefixForInline, rValue)
+		// an inline map takes the keys of its parent struct which no other field takes
+		parent := strings.TrimSuffix(strings.TrimSuffix(prefix, inline), ".")
+		return d.populateInline(parent, tagList, mapValueType, rValue)
 	}
+	mapKeys := d.getMapKeys(configValue, prefix)
 	for _, key := range mapKeys {
 		// if key itself has map value stored
 		if key == "" {
-			val := m.GetConfig(prefix)
+			_, val := d.lookup(prefix)
 			setVal := reflect.ValueOf(val)
 			if mapType != setVal.Type() {
 				return rValue, fmt.Errorf("invalid value for map %s", mapType.String())
@@ -321,12 +644,12 @@ func (m *Manager) populateMap(prefix string, mapType reflect.Type, rValues refle
 		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Float32, reflect.Float64, reflect.Uint, reflect.Uint8, reflect.Uint16,
 			reflect.Uint32, reflect.Uint64, reflect.Bool, reflect.Interface:
-			val := m.GetConfig(prefix + key)
+			configKey, val := d.lookup(prefix + key)
 			setVal := reflect.ValueOf(val)
 
 			// maybe next map type
 			if mapValueType != setVal.Type() {
-				returnCongValue, err := m.toRvalueType(setVal.Interface(), reflect.New(mapValueType).Elem())
+				returnCongValue, err := d.toRvalueType(setVal.Interface(), reflect.New(mapValueType).Elem())
 				if err != nil {
 					return rValue, fmt.Errorf(fmtValueNotMatched,
 						prefix+key, mapValueType, setVal.String())
@@ -336,11 +659,12 @@ func (m *Manager) populateMap(prefix string, mapType reflect.Type, rValues refle
 			if rValue.CanSet() {
 				rValue.SetMapIndex(reflect.ValueOf(key[1:]), setVal)
 			}
+			d.consume(configKey)
 		default:
 			splitKey := strings.Split(key, `.`)
 			mapKey := splitKey[1]
 			mapValue := reflect.New(mapValueType)
-			err := m.unmarshal(mapValue, getTagKey(prefix, mapKey))
+			err := d.unmarshal(mapValue, getTagKey(prefix, mapKey))
 			if err != nil {
 				return rValue, err
 			}
@@ -354,105 +678,71 @@ func (m *Manager) populateMap(prefix string, mapType reflect.Type, rValues refle
 	return rValue, nil
 }
 
-func isSliceContainString(str string, list []string) bool {
-	for _, value := range list {
-		if value == str {
-			return true
+// populateInline sets the keys under parent which are not the keys of the other fields into the inline map,
+// a key is consumed only once its value is set into the map.
+func (d *decoder) populateInline(parent string, fields []string, mapValueType reflect.Type,
+	rValue reflect.Value) (reflect.Value, error) {
+	prefix := ""
+	if parent != doNotConsiderTag {
+		prefix = d.fold(parent) + "."
+	}
+	taken := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		taken[d.fold(f)] = true
+	}
+	leaves := make(map[string]string)
+	nested := make(map[string]string)
+	for _, k := range d.keys() {
+		if !strings.HasPrefix(d.fold(k), prefix) {
+			continue
 		}
-	}
-	return false
-}
-
-func getUniqueKeys(strSlice []string) []string {
-	keys := make(map[string]bool)
-	var list []string
-	for _, val := range strSlice {
-		if _, value := keys[val]; !value {
-			keys[val] = true
-			list = append(list, val)
+		rest := k[len(prefix):]
+		name := strings.SplitN(rest, ".", 2)[0]
+		if taken[d.fold(name)] {
+			continue
+		}
+		if name == rest {
+			leaves[name] = k
+		} else {
+			nested[name] = k[:len(prefix)+len(name)]
 		}
 	}
 
-	return list
-}
-
-func checkAndReplaceInline(prefix string, tagList []string, configValue map[string]interface{}) ([]string, []string) {
-	var (
-		inlineExist                                     bool
-		updatedTagList, inlineVal, uniqueVal, inlinePfx []string
-		indexPrefix                                     int
-		heapData                                        string
-	)
-
-	firstValue := strings.Split(prefix, ".inline")
-	// updatedTagList slice contains all the tags of the structure which has inline tag
-	for _, value := range tagList {
-		updatedTagList = append(updatedTagList, firstValue[0]+"."+value)
-	}
-
-	for heap := range configValue {
-		// This condition is to get the index of inline tag so that it can be replace with the proper value
-		splittedPrefix := strings.Split(prefix, ".")
-		if len(splittedPrefix) != 0 {
-			for i, j := range splittedPrefix {
-				if j == inline {
-					indexPrefix = i
-				}
-			}
+	for name, key := range leaves {
+		_, val := d.lookup(key)
+		if val == nil || !takesValue(mapValueType) {
+			// not consumed, a strict Unmarshal reports it
+			continue
 		}
-
-		splittedHeap := strings.Split(heap, ".")
-		if len(splittedPrefix) != len(splittedHeap) {
-			// checks all the word before inline tag should be equal
-			// ex: if prefix is "cse.loadbalance.inline" and the heap is "cse.loadbalance.stratergy" then only we should consider
-			for i := 0; i < indexPrefix; i++ {
-				if splittedHeap[i] == splittedPrefix[i] {
-					inlineExist = true
-				} else {
-					inlineExist = false
-					break
-				}
-			}
-
-			if inlineExist {
-				for index, heapValue := range splittedHeap {
-					if index > indexPrefix {
-						break
-					}
-
-					heapData = heapData + "." + heapValue
-					heapData = strings.TrimPrefix(heapData, ".")
-				}
-
-				if !isSliceContainString(heapData, updatedTagList) {
-					inlineVal = append(inlineVal, splittedHeap[indexPrefix])
-				}
+		setVal := reflect.ValueOf(val)
+		if setVal.Type() != mapValueType {
+			converted, err := d.toRvalueType(val, reflect.New(mapValueType).Elem())
+			if err != nil {
+				// not consumed, a strict Unmarshal reports it
+				continue
 			}
+			setVal = converted
 		}
+		rValue.SetMapIndex(reflect.ValueOf(name), setVal)
+		d.consume(key)
 	}
-
-	inlineVal = getUniqueKeys(inlineVal)
-	for _, v := range inlineVal {
-		if !isSliceContainString(v, tagList) {
-			uniqueVal = append(uniqueVal, v)
+	for name, key := range nested {
+		if _, ok := leaves[name]; ok {
+			continue
 		}
+		if mapValueType.Kind() == reflect.Interface {
+			// the keys under name are set as nested maps
+			rValue.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(d.m.GetTree(d.managerKey(key))))
+			d.consume(key)
+			continue
+		}
+		mapValue := reflect.New(mapValueType)
+		if err := d.unmarshal(mapValue, key); err != nil {
+			return rValue, err
+		}
+		rValue.SetMapIndex(reflect.ValueOf(name), mapValue.Elem())
 	}
-
-	for _, v := range uniqueVal {
-		inlinePfx = append(inlinePfx, firstValue[0]+"."+v)
-	}
-
-	return inlinePfx, uniqueVal
-}
-
-func checkPrefixForInline(prefix string, tagList []string, configValue map[string]interface{}) ([]string, []string) {
-	var inlineVal, pfxInline []string
-
-	if strings.Contains(prefix, inline) {
-		pfxInline, inlineVal = checkAndReplaceInline(prefix, tagList, configValue)
-	}
-
-	return pfxInline, inlineVal
+	return rValue, nil
 }
 
 func checkPrefix(heap, prefix string) (bool, int) {
@@ -475,19 +765,21 @@ func checkPrefix(heap, prefix string) (bool, int) {
 }
 
 // set values in object.
-func (m *Manager) setValue(rValue reflect.Value, keyName string) error {
-	configValue := m.GetConfig(keyName)
+func (d *decoder) setValue(rValue reflect.Value, keyName string) error {
+	configKey, configValue := d.lookup(keyName)
 	if configValue == nil {
+		d.markUnset(keyName)
 		return nil
 	}
+	d.consume(configKey)
 
 	// assign value if assignable
 	configRValue := reflect.ValueOf(configValue)
 
-	returnCongValue, err := m.toRvalueType(configRValue.Interface(), rValue)
+	returnCongValue, err := d.toRvalueType(configRValue.Interface(), rValue)
 	if err != nil {
-		return fmt.Errorf(fmtValueNotMatched,
-			keyName, rValue.Kind(), configRValue.Kind())
+		return fmt.Errorf(fmtValueNotMatched+", %s",
+			keyName, rValue.Type(), configRValue.Kind(), err)
 	}
 
 	if rValue.CanSet() {
@@ -498,19 +790,60 @@ func (m *Manager) setValue(rValue reflect.Value, keyName string) error {
 }
 
 // get key from tag.
-func (*Manager) getKeyName(fieldName string, fieldTagName reflect.StructTag) string {
-	tagName := fieldTagName.Get(configClientTag)
-	if tagName == "-" {
-		return ignoreField
-	} else if tagName == "" {
-		return toSnake(fieldName)
-	} else if tagName == ",inline" {
-		tag := strings.Split(tagName, ",")
-		tagName = tag[1]
-		return tagName
+func (d *decoder) getKeyName(fieldName string, fieldTag reflect.StructTag) string {
+	if name := tagKeyName(d.opts.TagNames, fieldTag); name != "" {
+		return name
 	}
+	return toSnake(fieldName)
+}
 
-	return tagName
+// tagKeyName returns the key given by the first of tagNames which gives a name, empty if none does.
+func tagKeyName(tagNames []string, fieldTag reflect.StructTag) string {
+	for _, tagKey := range tagNames {
+		tag, ok := fieldTag.Lookup(tagKey)
+		if !ok {
+			continue
+		}
+		tagOpts := strings.Split(tag, ",")
+		if tagOpts[0] == "-" && len(tagOpts) == 1 {
+			return ignoreField
+		}
+		for _, opt := range tagOpts[1:] {
+			if opt == inline || opt == squash {
+				return inline
+			}
+		}
+		if tagOpts[0] != "" {
+			return tagOpts[0]
+		}
+	}
+	return ""
+}
+
+// fieldKeyName returns the key of a field under prefix,
+// if keys are matched ignoring case and no tag gives a name, the snake case of the field name is tried first,
+// then the field name, so MaxConns matches both max_conns and maxconns.
+func (d *decoder) fieldKeyName(prefix string, field reflect.StructField) string {
+	keyName := d.getKeyName(field.Name, field.Tag)
+	if !d.opts.CaseInsensitive || tagKeyName(d.opts.TagNames, field.Tag) != "" ||
+		d.hasKey(getTagKey(prefix, keyName)) || !d.hasKey(getTagKey(prefix, field.Name)) {
+		return keyName
+	}
+	return field.Name
+}
+
+// hasKey checks if key, or a key under it, exists ignoring case.
+func (d *decoder) hasKey(key string) bool {
+	if _, v := d.lookup(key); v != nil {
+		return true
+	}
+	folded := strings.ToLower(normalizeIndexedKey(key)) + "."
+	for _, k := range d.keys() {
+		if strings.HasPrefix(strings.ToLower(normalizeIndexedKey(k)), folded) {
+			return true
+		}
+	}
+	return false
 }
 
 // convert camel case to snake case.
@@ -531,10 +864,18 @@ func toSnake(in string) string {
 }
 
 // ToRvalueType Deserializes the object to a particular type.
-func (m *Manager) toRvalueType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
+func (d *decoder) toRvalueType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
 	convertType := rValue.Type()
 	returnValue = reflect.New(convertType).Elem()
 
+	if v, ok, err := decode(confValue, convertType); ok {
+		if err != nil {
+			return returnValue, err
+		}
+		returnValue.Set(v)
+		return returnValue, nil
+	}
+
 	switch convertType.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		returnInt := cast.ToInt64(confValue)
@@ -557,11 +898,15 @@ func (m *Manager) toRvalueType(confValue interface{}, rValue reflect.Value) (ret
 		returnValue.SetBool(returnBool)
 
 	case reflect.Array, reflect.Slice:
-		return m.toArrayType(confValue, rValue)
+		return d.toArrayType(confValue, rValue)
 	case reflect.Struct:
-		return m.toStructType(confValue, rValue)
+		return d.toStructType(confValue, rValue)
 	case reflect.Ptr:
-		return m.toPtrType(confValue, rValue)
+		return d.toPtrType(confValue, rValue)
+	case reflect.Interface:
+		if confValue != nil && reflect.TypeOf(confValue).Implements(convertType) {
+			returnValue.Set(reflect.ValueOf(confValue))
+		}
 	default:
 		err = errors.New("can not convert type")
 	}
@@ -570,7 +915,7 @@ func (m *Manager) toRvalueType(confValue interface{}, rValue reflect.Value) (ret
 }
 
 // toArrayType Deserializes the Array to a particular type.
-func (m *Manager) toArrayType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
+func (d *decoder) toArrayType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
 	convertType := rValue.Type()
 	returnValue = reflect.New(convertType).Elem()
 
@@ -594,7 +939,7 @@ func (m *Manager) toArrayType(confValue interface{}, rValue reflect.Value) (retu
 	j := 0
 	for i := 0; i < l; i++ {
 		e := reflect.New(et).Elem()
-		if r, err := m.toRvalueType(to[i], e); err == nil {
+		if r, err := d.toRvalueType(to[i], e); err == nil {
 			returnValue.Index(j).Set(r)
 			j++
 		}
@@ -608,7 +953,7 @@ func (m *Manager) toArrayType(confValue interface{}, rValue reflect.Value) (retu
 }
 
 // ToRvalueType Deserializes the Struct to a particular type.
-func (m *Manager) toStructType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
+func (d *decoder) toStructType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
 	structType := rValue.Type()
 	returnValue = reflect.New(structType).Elem()
 	numOfField := structType.NumField()
@@ -616,9 +961,16 @@ func (m *Manager) toStructType(confValue interface{}, rValue reflect.Value) (ret
 	for i := 0; i < numOfField; i++ {
 		structField := structType.Field(i)
 		fieldValue := rValue.Field(i)
-		keyName := m.getKeyName(structField.Name, structField.Tag)
+		keyName := d.getKeyName(structField.Name, structField.Tag)
+		if keyName == ignoreField {
+			continue
+		}
 		if v, ok := confValue.(map[string]interface{}); ok {
-			r, err := m.toRvalueType(v[keyName], fieldValue)
+			value := d.mapValue(v, keyName)
+			if value == nil && d.opts.CaseInsensitive && tagKeyName(d.opts.TagNames, structField.Tag) == "" {
+				value = d.mapValue(v, structField.Name)
+			}
+			r, err := d.toRvalueType(value, fieldValue)
 			if err == nil && fieldValue.CanSet() {
 				fieldValue.Set(r)
 			}
@@ -629,34 +981,34 @@ func (m *Manager) toStructType(confValue interface{}, rValue reflect.Value) (ret
 	return returnValue, err
 }
 
+// mapValue returns the value of key in m.
+func (d *decoder) mapValue(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok || !d.opts.CaseInsensitive {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
 // ToRvalueType Deserializes the Ptr to a particular type.
-func (m *Manager) toPtrType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
+func (d *decoder) toPtrType(confValue interface{}, rValue reflect.Value) (returnValue reflect.Value, err error) {
 	convertType := rValue.Type()
 	returnValue = reflect.New(convertType).Elem()
 
-	if rValue.IsNil() {
-		ptrValue := reflect.New(rValue.Type().Elem())
-		_, err := m.toRvalueType(confValue, ptrValue)
-		if err != nil {
-			return returnValue, err
-		}
-
-		if rValue.CanSet() {
-			rValue.Set(ptrValue)
-			returnValue.Set(rValue)
-		}
-
-		return returnValue, err
+	ptrValue := reflect.New(convertType.Elem())
+	if !rValue.IsNil() {
+		ptrValue.Elem().Set(rValue.Elem())
 	}
-
-	if rValue.Elem().Kind() == reflect.Ptr {
-		ptrValue := rValue.Elem()
-		_, err := m.toRvalueType(confValue, ptrValue)
-		if err != nil {
-			return returnValue, err
-		}
+	elemValue, err := d.toRvalueType(confValue, ptrValue.Elem())
+	if err != nil {
+		return returnValue, err
 	}
+	ptrValue.Elem().Set(elemValue)
+	returnValue.Set(ptrValue)
 
-	_, err = m.toRvalueType(confValue, rValue.Elem())
-	return returnValue, err
+	return returnValue, nil
 }
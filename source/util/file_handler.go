@@ -1,12 +1,14 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"path/filepath"
+	"regexp"
+	"strconv"
 
-	"github.com/sirupsen/logrus"
-
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 // FileHandler decide how to convert a file content into key values
@@ -15,81 +17,264 @@ type FileHandler func(filePath string, content []byte) (map[string]interface{},
 
 // Convert2JavaProps is a FileHandler
 // it convert the yaml content into java props.
+// a file can hold several documents, the keys of a later document override the ones of the earlier documents.
 func Convert2JavaProps(_ string, content []byte) (map[string]interface{}, error) {
-	configMap := make(map[string]interface{})
+	return yamlProps(content, false)
+}
 
-	ss := yaml.MapSlice{}
-	err := yaml.Unmarshal(content, &ss)
-	if err != nil {
-		return nil, fmt.Errorf("yaml unmarshal [%s] failed, %s", content, err)
-	}
-	configMap = retrieveItems("", ss)
+// Convert2IndexedJavaProps is a FileHandler
+// it converts the yaml content into java props like Convert2JavaProps,
+// but flattens arrays into indexed keys, for example servers.0.host,
+// so that a single element can be overridden by other sources.
+func Convert2IndexedJavaProps(_ string, content []byte) (map[string]interface{}, error) {
+	return yamlProps(content, true)
+}
 
-	return configMap, nil
+// ParseError tells where a yaml content is invalid,
+// Column is 0 if the yaml parser does not report it.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
 }
-func retrieveItems(prefix string, subItems yaml.MapSlice) map[string]interface{} {
-	if prefix != "" {
-		prefix += "."
+
+func (e *ParseError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("yaml: line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("yaml: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+var yamlErrLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// toParseError converts the errors of the yaml decoder into ParseError when they carry a line.
+func toParseError(err error) error {
+	sub := yamlErrLine.FindStringSubmatch(err.Error())
+	if sub == nil {
+		return err
 	}
+	line, _ := strconv.Atoi(sub[1])
+	return &ParseError{Line: line, Msg: sub[2]}
+}
+
+func nodeError(n *yaml.Node, format string, args ...interface{}) error {
+	return &ParseError{Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+}
 
+func yamlProps(content []byte, flattenArrays bool) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yaml unmarshal failed, %w", toParseError(err))
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := resolveAlias(doc.Content[0])
+		if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+			continue
+		}
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("yaml unmarshal failed, %w", nodeError(root, "the document is not a mapping"))
+		}
+		items, err := retrieveItems("", root, flattenArrays)
+		if err != nil {
+			return nil, fmt.Errorf("yaml unmarshal failed, %w", err)
+		}
+		for k, v := range items {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// mappingPair is a key value of a mapping node, after the merge keys are expanded
+type mappingPair struct {
+	key   string
+	value *yaml.Node
+}
 
-	for _, item := range subItems {
-		//check the item key first
-		k, ok := checkKey(item.Key)
-		if !ok {
+// mappingPairs returns the key values of a mapping node,
+// the key values of the mappings merged by << come after the explicit ones and do not override them,
+// and the first merged mapping wins over the later ones.
+func mappingPairs(n *yaml.Node) ([]mappingPair, error) {
+	var pairs, merged []mappingPair
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := resolveAlias(n.Content[i]), n.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return nil, nodeError(key, "the key is not a scalar")
+		}
+		if key.Tag != "!!merge" {
+			pairs = append(pairs, mappingPair{key: key.Value, value: value})
 			continue
 		}
-		//If there are sub-items existing
-		switch item.Value.(type) {
+		sources := []*yaml.Node{value}
+		if v := resolveAlias(value); v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, source := range sources {
+			source = resolveAlias(source)
+			if source.Kind != yaml.MappingNode {
+				return nil, nodeError(source, "the value of the merge key is not a mapping")
+			}
+			sub, err := mappingPairs(source)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, sub...)
+		}
+	}
+	seen := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		seen[p.key] = true
+	}
+	for _, p := range merged {
+		if !seen[p.key] {
+			seen[p.key] = true
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs, nil
+}
+
+func retrieveItems(prefix string, n *yaml.Node, flattenArrays bool) (map[string]interface{}, error) {
+	if prefix != "" {
+		prefix += "."
+	}
+	pairs, err := mappingPairs(n)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{}
+	for _, p := range pairs {
+		key, value := prefix+p.key, resolveAlias(p.value)
+		switch value.Kind {
 		//sub items in a map
-		case yaml.MapSlice:
-			subResult := retrieveItems(prefix+item.Key.(string), item.Value.(yaml.MapSlice))
+		case yaml.MappingNode:
+			subResult, err := retrieveItems(key, value, flattenArrays)
+			if err != nil {
+				return nil, err
+			}
 			for k, v := range subResult {
 				result[k] = v
 			}
 
 		// sub items in an array
-		case []interface{}:
-			keyVal := item.Value.([]interface{})
-			result[prefix+k] = retrieveItemInSlice(keyVal)
-
-		// sub item is a string
-		case string:
-			result[prefix+k] = ExpandValueEnv(item.Value.(string))
+		case yaml.SequenceNode:
+			if flattenArrays && len(value.Content) != 0 {
+				subResult, err := retrieveIndexedItems(key, value)
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range subResult {
+					result[k] = v
+				}
+				continue
+			}
+			v, err := retrieveNode(value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = v
 
-		// sub item in other type
 		default:
-			result[prefix+k] = item.Value
+			v, err := retrieveScalar(value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = v
 		}
 	}
+	return result, nil
+}
 
-	return result
+// retrieveNode converts a node in an array, the maps are flattened on their own.
+func retrieveNode(n *yaml.Node) (interface{}, error) {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		return retrieveItems("", n, false)
+	case yaml.SequenceNode:
+		value := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := retrieveNode(item)
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, v)
+		}
+		return value, nil
+	default:
+		return retrieveScalar(n)
+	}
 }
 
-func checkKey(key interface{}) (string, bool) {
-	k, ok := key.(string)
-	if !ok {
-		logrus.Error("yaml tag is not string", logrus.WithField(
-			"key", key,
-		))
-		return "", false
+// yaml11Bools are the plain scalars which YAML 1.1 resolves to bool, yaml.v3 keeps them as strings.
+var yaml11Bools = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+}
+
+// retrieveScalar decodes a scalar node, the env variables in strings are expanded.
+// the values are resolved like yaml.v2 did, so yes, on and their kind are bools,
+// and the timestamps are kept as they are written.
+func retrieveScalar(n *yaml.Node) (interface{}, error) {
+	if n.Tag == "!!timestamp" {
+		return n.Value, nil
+	}
+	if b, ok := yaml11Bools[n.Value]; ok && (n.Tag == "!!bool" || n.Tag == "!!str" && n.Style == 0) {
+		return b, nil
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, nodeError(n, "%s", err)
 	}
-	return k, true
+	if s, ok := v.(string); ok {
+		return ExpandValueEnv(s), nil
+	}
+	return v, nil
 }
 
-func retrieveItemInSlice(value []interface{}) []interface{} {
-	for i, v := range value {
-		switch v.(type) {
-		case yaml.MapSlice:
-			value[i] = retrieveItems("", v.(yaml.MapSlice))
-		case string:
-			value[i] = ExpandValueEnv(v.(string))
+// retrieveIndexedItems flattens the elements of an array into keys like prefix.0, prefix.1.name.
+func retrieveIndexedItems(prefix string, n *yaml.Node) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for i, item := range n.Content {
+		key := prefix + "." + strconv.Itoa(i)
+		item = resolveAlias(item)
+		var sub map[string]interface{}
+		var err error
+		switch {
+		case item.Kind == yaml.MappingNode:
+			sub, err = retrieveItems(key, item, true)
+		case item.Kind == yaml.SequenceNode && len(item.Content) != 0:
+			sub, err = retrieveIndexedItems(key, item)
 		default:
-			//do nothing
+			var v interface{}
+			v, err = retrieveNode(item)
+			sub = map[string]interface{}{key: v}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range sub {
+			result[k] = v
 		}
 	}
-	return value
+	return result, nil
 }
 
 // UseFileNameAsKeyContentAsValue is a FileHandler, it sets the yaml file name as key and the content as value.
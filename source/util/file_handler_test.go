@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	yamlv2 "gopkg.in/yaml.v2"
 )
 
 func TestConvert2JavaProps(t *testing.T) {
@@ -44,3 +45,101 @@ c:
 	assert.NoError(t, err)
 	assert.Equal(t, b, m["test.yaml"])
 }
+
+func TestConvert2IndexedJavaProps(t *testing.T) {
+	b := []byte(`
+servers:
+ - host: 10.0.0.1
+   port: 8080
+   tags: [a, b]
+ - host: 10.0.0.2
+empty: []
+`)
+	m, err := Convert2IndexedJavaProps("test.yaml", b)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", m["servers.0.host"])
+	assert.Equal(t, 8080, m["servers.0.port"])
+	assert.Equal(t, "b", m["servers.0.tags.1"])
+	assert.Equal(t, "10.0.0.2", m["servers.1.host"])
+	assert.Equal(t, []interface{}{}, m["empty"])
+	_, ok := m["servers"]
+	assert.False(t, ok)
+}
+
+func TestConvert2JavaPropsDocuments(t *testing.T) {
+	b := []byte(`
+defaults: &defaults
+  timeout: 3
+  retry: 1
+extra: &extra
+  retry: 5
+  zone: z1
+db:
+  <<: [*defaults, *extra]
+  retry: 2
+cache:
+  <<: *defaults
+hosts: &hosts [a, b]
+backup: *hosts
+1: one
+true: yes
+---
+# an empty document
+---
+db:
+  timeout: 10
+`)
+	m, err := Convert2JavaProps("test.yaml", b)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, m["db.timeout"])
+	assert.Equal(t, 2, m["db.retry"])
+	assert.Equal(t, "z1", m["db.zone"])
+	assert.Equal(t, 3, m["cache.timeout"])
+	assert.Equal(t, 1, m["cache.retry"])
+	assert.Equal(t, []interface{}{"a", "b"}, m["backup"])
+	assert.Equal(t, "one", m["1"])
+	assert.Equal(t, true, m["true"])
+	_, ok := m["db.<<"]
+	assert.False(t, ok)
+}
+
+func TestConvert2JavaPropsInvalid(t *testing.T) {
+	_, err := Convert2JavaProps("test.yaml", []byte("a: 1\n\tb: 2\n"))
+	var pe *ParseError
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 2, pe.Line)
+
+	_, err = Convert2JavaProps("test.yaml", []byte("a: 1\nb:\n  ? [c]\n  : 2\n"))
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 3, pe.Line)
+	assert.Equal(t, 5, pe.Column)
+	assert.Contains(t, err.Error(), "line 3, column 5")
+
+	_, err = Convert2JavaProps("test.yaml", []byte("a: 1\n---\n- b\n"))
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 3, pe.Line)
+	assert.Equal(t, 1, pe.Column)
+
+	_, err = Convert2JavaProps("test.yaml", []byte("a:\n  <<: 1\n"))
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 2, pe.Line)
+}
+
+func TestConvert2JavaPropsYAML11(t *testing.T) {
+	for _, scalar := range []string{
+		"on", "On", "ON", "off", "Off", "OFF", "yes", "Yes", "YES", "no", "No", "NO",
+		"y", "Y", "n", "N", "true", "False", "!!bool yes", "!!str on", "'on'", `"yes"`, "yEs",
+		"2001-12-14t21:59:43.10-05:00", "2001-12-14 21:59:43.10 -5", "2002-12-14", "!!timestamp 2002-12-14",
+		"0777", "0x1f", "1_000", "1e3", ".inf", "~", "null", "12:30:00", "1.0", "9223372036854775808",
+	} {
+		content := []byte("a: " + scalar + "\nb:\n  - " + scalar)
+		expected := map[string]interface{}{}
+		err := yamlv2.Unmarshal(content, &expected)
+		assert.NoError(t, err, scalar)
+
+		m, err := Convert2JavaProps("test.yaml", content)
+		assert.NoError(t, err, scalar)
+		assert.Equal(t, expected["a"], m["a"], scalar)
+		assert.Equal(t, expected["b"], m["b"], scalar)
+	}
+}
@@ -0,0 +1,371 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	handlersMux sync.RWMutex
+	// fileHandlers are the FileHandlers by file extension
+	fileHandlers = map[string]FileHandler{
+		".yaml":       Convert2JavaProps,
+		".yml":        Convert2JavaProps,
+		".json":       JSON2JavaProps,
+		".toml":       TOML2JavaProps,
+		".properties": Properties2JavaProps,
+		".ini":        INI2JavaProps,
+	}
+)
+
+// RegisterFileHandler registers the FileHandler of the files with extension ext, like .toml,
+// it replaces the registered one, a nil FileHandler removes it. the extension is case insensitive.
+func RegisterFileHandler(ext string, h FileHandler) {
+	handlersMux.Lock()
+	defer handlersMux.Unlock()
+	if h == nil {
+		delete(fileHandlers, normalizeExt(ext))
+		return
+	}
+	fileHandlers[normalizeExt(ext)] = h
+}
+
+// FileHandlerFor returns the FileHandler registered for the extension of filePath,
+// Convert2JavaProps if no FileHandler is registered for it.
+func FileHandlerFor(filePath string) FileHandler {
+	handlersMux.RLock()
+	defer handlersMux.RUnlock()
+	if h, ok := fileHandlers[normalizeExt(filepath.Ext(filePath))]; ok {
+		return h
+	}
+	return Convert2JavaProps
+}
+
+// HasFileHandler tells whether a FileHandler is registered for the extension of filePath.
+func HasFileHandler(filePath string) bool {
+	handlersMux.RLock()
+	defer handlersMux.RUnlock()
+	_, ok := fileHandlers[normalizeExt(filepath.Ext(filePath))]
+	return ok
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// JSON2JavaProps is a FileHandler
+// it converts the json content into java props like Convert2JavaProps does for yaml.
+func JSON2JavaProps(filePath string, content []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return nil, jsonError(filePath, content, err)
+	}
+	return retrieveMap("", m), nil
+}
+
+// jsonError tells the file and the line and column where the json can not be parsed,
+// the content is not included since it may hold secrets.
+func jsonError(filePath string, content []byte, err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		offset    int64
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return fmt.Errorf("json unmarshal [%s] failed, %s", filePath, err)
+	}
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	line, column := 1, 1
+	for _, c := range content[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return fmt.Errorf("json unmarshal [%s] failed at line %d column %d, %s", filePath, line, column, err)
+}
+
+// TOML2JavaProps is a FileHandler
+// it converts the toml content into java props like Convert2JavaProps does for yaml,
+// tables become dotted keys, arrays of tables become arrays of maps, and dates are kept as strings.
+func TOML2JavaProps(filePath string, content []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := toml.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("toml unmarshal [%s] failed, %s", filePath, err)
+	}
+	return retrieveMap("", tomlValue(m).(map[string]interface{})), nil
+}
+
+// tomlValue converts the values decoded by toml into the ones Convert2JavaProps gives for yaml.
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = tomlValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = tomlValue(item)
+		}
+		return arr
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tomlValue(item)
+		}
+		return v
+	case int64:
+		if int64(int(v)) == v {
+			return int(v)
+		}
+		return v
+	case time.Time:
+		// the dates and times without offset are decoded in the zones named by their kind
+		switch v.Location().String() {
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// retrieveMap flattens the nested maps of m into keys joined by dots,
+// the maps in arrays are flattened on their own.
+func retrieveMap(prefix string, m map[string]interface{}) map[string]interface{} {
+	if prefix != "" {
+		prefix += "."
+	}
+	result := map[string]interface{}{}
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			for subK, subV := range retrieveMap(prefix+k, sub) {
+				result[subK] = subV
+			}
+			continue
+		}
+		result[prefix+k] = retrieveValue(v)
+	}
+	return result
+}
+
+func retrieveValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return retrieveMap("", t)
+	case []interface{}:
+		for i, item := range t {
+			t[i] = retrieveValue(item)
+		}
+		return t
+	case string:
+		return ExpandValueEnv(t)
+	case json.Number:
+		if i, err := strconv.Atoi(t.String()); err == nil {
+			return i
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return t.String()
+		}
+		return f
+	default:
+		return v
+	}
+}
+
+// Properties2JavaProps is a FileHandler
+// it converts the content of a java .properties file into key values,
+// the values are strings, and the env variables like ${NAME||default} in them are expanded.
+func Properties2JavaProps(_ string, content []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	lines, err := logicalLines(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		key, value := splitProperty(line)
+		k, err := unescapeProperty(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := unescapeProperty(value)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = ExpandValueEnv(v)
+	}
+	return result, nil
+}
+
+// logicalLines joins the lines ending with an odd number of backslashes to the next line,
+// and drops blank lines and comments.
+func logicalLines(content []byte) ([]string, error) {
+	var lines []string
+	var current strings.Builder
+	continued := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if !continued && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		continued = trailing%2 == 1
+		if continued {
+			line = line[:len(line)-1]
+		}
+		current.WriteString(line)
+		if !continued {
+			lines = append(lines, current.String())
+			current.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read properties failed, %s", err)
+	}
+	if current.Len() != 0 {
+		lines = append(lines, current.String())
+	}
+	return lines, nil
+}
+
+// splitProperty splits a line at the first unescaped =, : or white space.
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			rest := strings.TrimLeft(line[i:], " \t\f")
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeft(rest[1:], " \t\f")
+			}
+			return line[:i], rest
+		}
+	}
+	return line, ""
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape in [%s]", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape in [%s], %s", s, err)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteRune(r)
+			i += size - 1
+		}
+	}
+	return b.String(), nil
+}
+
+// INI2JavaProps is a FileHandler
+// it converts the content of an ini file into key values, the keys in a [section] are prefixed with section,
+// the values are strings, the quotes around them are removed, and the env variables in them are expanded.
+func INI2JavaProps(_ string, content []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid section at line %d: %s", n, line)
+			}
+			section = strings.TrimSpace(line[1:end])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid key value at line %d: %s", n, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		if section != "" {
+			key = section + "." + key
+		}
+		result[key] = ExpandValueEnv(unquoteINI(strings.TrimSpace(line[i+1:])))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ini failed, %s", err)
+	}
+	return result, nil
+}
+
+// unquoteINI removes the quotes around value, or the inline comment after an unquoted value.
+func unquoteINI(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	for _, sep := range []string{" ;", " #", "\t;", "\t#"} {
+		if i := strings.Index(value, sep); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,188 @@
+package util
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHandlerFor(t *testing.T) {
+	m, err := FileHandlerFor("/etc/app.JSON")("app.json", []byte(`{"a": {"b": 1}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a.b"])
+
+	m, err = FileHandlerFor("/etc/app.conf")("app.conf", []byte("a:\n  b: 1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a.b"])
+
+	assert.False(t, HasFileHandler("/etc/app.conf"))
+	RegisterFileHandler("conf", UseFileNameAsKeyContentAsValue)
+	defer RegisterFileHandler(".conf", nil)
+	assert.True(t, HasFileHandler("/etc/app.conf"))
+	m, err = FileHandlerFor("/etc/app.conf")("/etc/app.conf", []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), m["app.conf"])
+}
+
+func TestJSON2JavaProps(t *testing.T) {
+	os.Setenv("JSON_HOST", "10.0.0.1")
+	defer os.Unsetenv("JSON_HOST")
+	m, err := JSON2JavaProps("app.json", []byte(`{
+	"db": {"host": "${JSON_HOST||localhost}", "port": 3306, "ratio": 0.5, "ssl": true},
+	"servers": [{"name": "a", "tags": {"zone": "z1"}}, "b"]
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", m["db.host"])
+	assert.Equal(t, 3306, m["db.port"])
+	assert.Equal(t, 0.5, m["db.ratio"])
+	assert.Equal(t, true, m["db.ssl"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "a", "tags.zone": "z1"}, "b"}, m["servers"])
+
+	_, err = JSON2JavaProps("app.json", []byte(`{"a": `))
+	assert.Error(t, err)
+
+	_, err = JSON2JavaProps("app.json", []byte("{\n  \"password\": \"s3cret\",\n  x\n}"))
+	assert.EqualError(t, err, "json unmarshal [app.json] failed at line 3 column 4, invalid character 'x' looking for beginning of object key string")
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestTOML2JavaProps(t *testing.T) {
+	m, err := TOML2JavaProps("app.toml", []byte(`
+# comment
+title = "TOML \"example\"" # comment
+path = 'C:\Users\app'
+hex = 0xff
+big = 1_000_000
+ratio = 6.5e-1
+inf = -inf
+enabled = true
+created = 1979-05-27 07:32:00Z
+day = 1979-05-27
+local = 1979-05-27T07:32:00
+clock = 07:32:00
+site."google.com" = "g"
+multi = """
+line1 \
+  line2
+line3"""
+literal = '''
+raw \n text'''
+
+[db]
+host = "10.0.0.1"
+ports = [ 8000,
+  8001, # comment
+]
+conn = { timeout = 3, retry = { max = 2 } }
+
+[db.pool]
+size = 10
+
+[[servers]]
+name = "a"
+[servers.meta]
+zone = "z1"
+
+[[servers]]
+name = "b"
+[servers.meta]
+zone = "z2"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, `TOML "example"`, m["title"])
+	assert.Equal(t, `C:\Users\app`, m["path"])
+	assert.Equal(t, 255, m["hex"])
+	assert.Equal(t, 1000000, m["big"])
+	assert.Equal(t, 0.65, m["ratio"])
+	assert.True(t, math.IsInf(m["inf"].(float64), -1))
+	assert.Equal(t, true, m["enabled"])
+	assert.Equal(t, "1979-05-27T07:32:00Z", m["created"])
+	assert.Equal(t, "1979-05-27", m["day"])
+	assert.Equal(t, "1979-05-27T07:32:00", m["local"])
+	assert.Equal(t, "07:32:00", m["clock"])
+	assert.Equal(t, "g", m["site.google.com"])
+	assert.Equal(t, "line1 line2\nline3", m["multi"])
+	assert.Equal(t, `raw \n text`, m["literal"])
+	assert.Equal(t, "10.0.0.1", m["db.host"])
+	assert.Equal(t, []interface{}{8000, 8001}, m["db.ports"])
+	assert.Equal(t, 3, m["db.conn.timeout"])
+	assert.Equal(t, 2, m["db.conn.retry.max"])
+	assert.Equal(t, 10, m["db.pool.size"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "meta.zone": "z1"},
+		map[string]interface{}{"name": "b", "meta.zone": "z2"},
+	}, m["servers"])
+}
+
+func TestTOML2JavaPropsInvalid(t *testing.T) {
+	for _, content := range []string{
+		`a = `,
+		`a = "unclosed`,
+		`a = 1 b = 2`,
+		"a = 1\na = 2",
+		"[a]\n[a]",
+		"a = 1\n[a]",
+		`a = [1, 2`,
+		`a = { b = 1`,
+		`[a`,
+		`a = 0xzz`,
+	} {
+		_, err := TOML2JavaProps("app.toml", []byte(content))
+		assert.Error(t, err, content)
+	}
+}
+
+func TestProperties2JavaProps(t *testing.T) {
+	m, err := Properties2JavaProps("app.properties", []byte(`
+# comment
+! comment
+db.host = 10.0.0.1
+db.port:3306
+db.user admin
+db.url = jdbc:mysql://${PROPS_HOST||localhost}:3306/db
+message = hello \
+          world
+key\ with\ spaces = a\=b
+unicode = caf\u00e9
+empty
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"db.host":         "10.0.0.1",
+		"db.port":         "3306",
+		"db.user":         "admin",
+		"db.url":          "jdbc:mysql://localhost:3306/db",
+		"message":         "hello world",
+		"key with spaces": "a=b",
+		"unicode":         "café",
+		"empty":           "",
+	}, m)
+}
+
+func TestINI2JavaProps(t *testing.T) {
+	m, err := INI2JavaProps("app.ini", []byte(`
+; comment
+name = app
+
+[db]
+host = "10.0.0.1"
+port: 3306 ; inline comment
+
+[db.pool]
+size = 10
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":         "app",
+		"db.host":      "10.0.0.1",
+		"db.port":      "3306",
+		"db.pool.size": "10",
+	}, m)
+
+	_, err = INI2JavaProps("app.ini", []byte("[db\nhost=a"))
+	assert.Error(t, err)
+	_, err = INI2JavaProps("app.ini", []byte("host"))
+	assert.Error(t, err)
+}
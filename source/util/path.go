@@ -0,0 +1,97 @@
+package util
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// ResolvePath returns the absolute path of p with its symlinks resolved, p itself if they can not be resolved.
+func ResolvePath(p string) string {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return p
+	}
+	if abs, err := filepath.Abs(resolved); err == nil {
+		return abs
+	}
+	return resolved
+}
+
+// Links records the file each managed file resolves to through symlinks,
+// so that a write to the resolved file, or a symlink swap like the ..data of a kubernetes ConfigMap volume,
+// is traced back to the managed files.
+type Links struct {
+	mux      sync.RWMutex
+	resolved map[string]string
+}
+
+// NewLinks creates Links without files.
+func NewLinks() *Links {
+	return &Links{resolved: make(map[string]string)}
+}
+
+// Track records the file filePath resolves to,
+// and returns the directories to watch, the one of filePath and the one of the resolved file.
+// the directories are watched instead of the files, so that a file replaced by a rename is noticed.
+func (l *Links) Track(filePath string) []string {
+	resolved := ResolvePath(filePath)
+	l.mux.Lock()
+	l.resolved[filePath] = resolved
+	l.mux.Unlock()
+	dirs := []string{filepath.Dir(filePath)}
+	if filepath.Dir(resolved) != dirs[0] {
+		dirs = append(dirs, filepath.Dir(resolved))
+	}
+	return dirs
+}
+
+// Untrack forgets filePath.
+func (l *Links) Untrack(filePath string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.resolved, filePath)
+}
+
+// Reset forgets all files.
+func (l *Links) Reset() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.resolved = make(map[string]string)
+}
+
+// Tracked tells whether filePath is a tracked file or the file one resolves to.
+func (l *Links) Tracked(filePath string) bool {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	for p, resolved := range l.resolved {
+		if p == filePath || resolved == filePath {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns the files whose resolved file is changedPath, or which resolve to another file
+// since a change in the directory of changedPath.
+func (l *Links) Changed(changedPath string) []string {
+	dir := filepath.Dir(changedPath)
+	l.mux.RLock()
+	candidates := make(map[string]string)
+	for filePath, resolved := range l.resolved {
+		if filePath == changedPath {
+			continue
+		}
+		if resolved == changedPath || filepath.Dir(filePath) == dir || filepath.Dir(resolved) == dir {
+			candidates[filePath] = resolved
+		}
+	}
+	l.mux.RUnlock()
+
+	files := make([]string, 0)
+	for filePath, resolved := range candidates {
+		if resolved == changedPath || ResolvePath(filePath) != resolved {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
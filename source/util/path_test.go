@@ -0,0 +1,44 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinks(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "..2024_01")
+	assert.NoError(t, os.Mkdir(dataDir, 0700))
+	target := filepath.Join(dataDir, "app.yaml")
+	assert.NoError(t, os.WriteFile(target, []byte("a: 1"), 0600))
+	link := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, os.Symlink(target, link))
+
+	l := NewLinks()
+	assert.ElementsMatch(t, []string{dir, ResolvePath(dataDir)}, l.Track(link))
+	assert.True(t, l.Tracked(link))
+	assert.True(t, l.Tracked(ResolvePath(target)))
+	assert.False(t, l.Tracked(filepath.Join(dir, "other.yaml")))
+
+	t.Run("a write to the resolved file changes the link", func(t *testing.T) {
+		assert.Equal(t, []string{link}, l.Changed(ResolvePath(target)))
+	})
+
+	t.Run("a symlink swap changes the link", func(t *testing.T) {
+		newDir := filepath.Join(dir, "..2024_02")
+		assert.NoError(t, os.Mkdir(newDir, 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(newDir, "app.yaml"), []byte("a: 2"), 0600))
+		assert.NoError(t, os.Remove(link))
+		assert.NoError(t, os.Symlink(filepath.Join(newDir, "app.yaml"), link))
+		assert.Equal(t, []string{link}, l.Changed(filepath.Join(dir, "..data")))
+	})
+
+	l.Untrack(link)
+	assert.False(t, l.Tracked(link))
+	l.Track(link)
+	l.Reset()
+	assert.False(t, l.Tracked(link))
+}
@@ -0,0 +1,204 @@
+package archaius
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/arielsrv/go-archaius/event"
+	"github.com/arielsrv/go-archaius/pkg/cast"
+	"github.com/arielsrv/go-archaius/source"
+)
+
+// SubConfig is a live view of the keys under a prefix,
+// its APIs use the keys relative to the prefix, for example Sub("redis").GetString("addr", "")
+// reads redis.addr, and its listeners only get the changes under the prefix.
+type SubConfig struct {
+	prefix string
+}
+
+// Sub returns the view of the keys under prefix.
+func Sub(prefix string) *SubConfig {
+	return &SubConfig{prefix: strings.Trim(prefix, keySeparator())}
+}
+
+// keySeparator returns the separator of keys, see WithKeySeparator.
+func keySeparator() string {
+	if manager == nil {
+		return event.DefaultSeparator
+	}
+	return manager.KeySeparator()
+}
+
+// Prefix returns the prefix of the view.
+func (s *SubConfig) Prefix() string {
+	return s.prefix
+}
+
+// Sub returns the view of the keys under prefix of this view.
+func (s *SubConfig) Sub(prefix string) *SubConfig {
+	return Sub(s.key(prefix))
+}
+
+func (s *SubConfig) key(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	if key == "" {
+		return s.prefix
+	}
+	return s.prefix + keySeparator() + key
+}
+
+// relative returns the key relative to the prefix, and false if key is not under the prefix.
+func (s *SubConfig) relative(key string) (string, bool) {
+	if s.prefix == "" {
+		return key, true
+	}
+	if !strings.HasPrefix(key, s.prefix+keySeparator()) {
+		return "", false
+	}
+	return key[len(s.prefix)+len(keySeparator()):], true
+}
+
+// Get is for to get the value of configuration key.
+func (s *SubConfig) Get(key string) interface{} {
+	return Get(s.key(key))
+}
+
+// GetValue return interface.
+func (s *SubConfig) GetValue(key string) cast.Value {
+	return GetValue(s.key(key))
+}
+
+// GetBool is gives the key value in the form of bool.
+func (s *SubConfig) GetBool(key string, defaultValue bool) bool {
+	return GetBool(s.key(key), defaultValue)
+}
+
+// GetInt gives the key value in the form of int.
+func (s *SubConfig) GetInt(key string, defaultValue int) int {
+	return GetInt(s.key(key), defaultValue)
+}
+
+// GetInt64 gives the key value in the form of int64.
+func (s *SubConfig) GetInt64(key string, defaultValue int64) int64 {
+	return GetInt64(s.key(key), defaultValue)
+}
+
+// GetString gives the key value in the form of string.
+func (s *SubConfig) GetString(key string, defaultValue string) string {
+	return GetString(s.key(key), defaultValue)
+}
+
+// Exist check the configuration key existence.
+func (s *SubConfig) Exist(key string) bool {
+	return Exist(s.key(key))
+}
+
+// Keys returns the sorted keys under the prefix, relative to it.
+func (s *SubConfig) Keys() []string {
+	keys := make([]string, 0)
+	for _, key := range manager.KeysWithPrefix(s.prefix) {
+		if k, ok := s.relative(key); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// UnmarshalConfig unmarshal the keys under the prefix into obj.
+func (s *SubConfig) UnmarshalConfig(obj interface{}, opts ...UnmarshalOption) error {
+	return manager.Unmarshal(obj, append(opts, source.WithPrefix(s.prefix))...)
+}
+
+// RegisterListener registers listener for the keys relative to the prefix,
+// like RegisterListener, a key is a regular expression, it is matched from the start of the relative key.
+// the event given to the listener has the relative key.
+func (s *SubConfig) RegisterListener(listenerObj event.Listener, keys ...string) error {
+	if listenerObj == nil {
+		return event.ErrNilListener
+	}
+	return manager.RegisterListener(subListener{sub: s.prefix, listener: listenerObj}, s.patterns(keys)...)
+}
+
+// UnRegisterListener remove listener.
+func (s *SubConfig) UnRegisterListener(listenerObj event.Listener, keys ...string) error {
+	if listenerObj == nil {
+		return event.ErrNilListener
+	}
+	return manager.UnRegisterListener(subListener{sub: s.prefix, listener: listenerObj}, s.patterns(keys)...)
+}
+
+// RegisterModuleListener registers module listener for the prefixes relative to the prefix,
+// without prefixes, the listener gets the changes of all keys under the prefix.
+func (s *SubConfig) RegisterModuleListener(listenerObj event.ModuleListener, prefixes ...string) error {
+	if listenerObj == nil {
+		return event.ErrNilListener
+	}
+	return manager.RegisterModuleListener(subModuleListener{sub: s.prefix, listener: listenerObj}, s.prefixes(prefixes)...)
+}
+
+// UnRegisterModuleListener remove module listener.
+func (s *SubConfig) UnRegisterModuleListener(listenerObj event.ModuleListener, prefixes ...string) error {
+	if listenerObj == nil {
+		return event.ErrNilListener
+	}
+	return manager.UnRegisterModuleListener(subModuleListener{sub: s.prefix, listener: listenerObj}, s.prefixes(prefixes)...)
+}
+
+func (s *SubConfig) patterns(keys []string) []string {
+	patterns := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if s.prefix == "" {
+			patterns = append(patterns, key)
+			continue
+		}
+		patterns = append(patterns, "^"+regexp.QuoteMeta(s.prefix+keySeparator())+"(?:"+key+")")
+	}
+	return patterns
+}
+
+func (s *SubConfig) prefixes(prefixes []string) []string {
+	if len(prefixes) == 0 {
+		return []string{s.prefix}
+	}
+	keys := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		keys = append(keys, s.key(p))
+	}
+	return keys
+}
+
+// subListener gives the events with keys relative to the prefix to listener.
+type subListener struct {
+	sub      string
+	listener event.Listener
+}
+
+// Event trims the prefix of the key.
+func (l subListener) Event(e *event.Event) {
+	l.listener.Event(relativeEvent(l.sub, e))
+}
+
+// subModuleListener gives the events with keys relative to the prefix to listener.
+type subModuleListener struct {
+	sub      string
+	listener event.ModuleListener
+}
+
+// Event trims the prefix of the keys.
+func (l subModuleListener) Event(events []*event.Event) {
+	relative := make([]*event.Event, 0, len(events))
+	for _, e := range events {
+		relative = append(relative, relativeEvent(l.sub, e))
+	}
+	l.listener.Event(relative)
+}
+
+func relativeEvent(prefix string, e *event.Event) *event.Event {
+	re := *e
+	if prefix != "" {
+		re.Key = strings.TrimPrefix(e.Key, prefix+keySeparator())
+	}
+	return &re
+}